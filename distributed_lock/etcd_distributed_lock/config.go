@@ -0,0 +1,57 @@
+package etcd_distributed_lock
+
+// 默认配置参数
+const (
+	// 默认阻塞时间
+	DefaultBlockWaitingSeconds = 5
+	// 默认分布式锁过期时间，即会话租约的 TTL
+	DefaultDistributedLockExpireSeconds = 30
+)
+
+// 锁配置
+type LockOptions struct {
+	blockMode           bool
+	blockWaitingSeconds int64
+	expireSeconds       int64
+	keepAliveMode       bool
+}
+
+type LockOption func(*LockOptions)
+
+func ActiveBlockMode() LockOption {
+	return func(o *LockOptions) {
+		o.blockMode = true
+	}
+}
+
+func SetBlockWaitingSeconds(bws int64) LockOption {
+	return func(o *LockOptions) {
+		o.blockWaitingSeconds = bws
+	}
+}
+
+// 会话租约的 TTL，未开启会话保活时，锁在 TTL 之后过期
+func SetExpireSeconds(es int64) LockOption {
+	return func(o *LockOptions) {
+		o.expireSeconds = es
+	}
+}
+
+// 会话保活模式，持有锁期间持续为会话租约续期，进程宕机后锁在 TTL 之后过期
+func ActiveKeepAliveMode() LockOption {
+	return func(o *LockOptions) {
+		o.keepAliveMode = true
+	}
+}
+
+func checkLockOptions(o *LockOptions) {
+	if o.blockMode && o.blockWaitingSeconds <= 0 {
+		o.blockWaitingSeconds = DefaultBlockWaitingSeconds
+	}
+	if o.expireSeconds > 0 {
+		return
+	}
+	// 用户未显式指定锁的过期时间，则会开启会话保活，与 RedisLock 的看门狗一致
+	o.expireSeconds = DefaultDistributedLockExpireSeconds
+	o.keepAliveMode = true
+}
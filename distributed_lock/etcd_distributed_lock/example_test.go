@@ -0,0 +1,34 @@
+package etcd_distributed_lock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 分布式用例
+func ExampleEtcdLock() {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{"127.0.0.1:2379"},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 阻塞模式，未指定过期时间时开启会话保活
+	lock := NewEtcdLock("my-lock", cli, ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	if err := lock.Lock(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("acquired lock")
+
+	if err := lock.Unlock(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("released lock")
+}
@@ -0,0 +1,176 @@
+package etcd_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const LockKeyPrefix = "/ETCD_LOCK_PRE_/"
+
+var ErrLockAcquiredByOthers = errors.New("lock is acquired by others")
+
+var ErrLockNotOwned = errors.New("lock is not owned by current session")
+
+func IsRetryableErr(err error) bool {
+	return errors.Is(err, ErrLockAcquiredByOthers)
+}
+
+// etcd分布式锁，基于会话租约和 concurrency.Mutex 实现，使用方式与 RedisLock 一致
+type EtcdLock struct {
+	LockOptions
+	key    string
+	client *clientv3.Client
+	// 本次持有锁期间的会话和互斥锁
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+// 初始化
+func NewEtcdLock(key string, client *clientv3.Client, opts ...LockOption) *EtcdLock {
+	e := EtcdLock{
+		key:    key,
+		client: client,
+	}
+	for _, opt := range opts {
+		opt(&e.LockOptions)
+	}
+	checkLockOptions(&e.LockOptions)
+	return &e
+}
+
+// lock key，持有者的 key 为 lock key 加上会话租约 ID
+func (e *EtcdLock) getLockKey() string {
+	return LockKeyPrefix + e.key + "/"
+}
+
+// 加锁
+func (e *EtcdLock) Lock(ctx context.Context) error {
+	return e.lock(ctx, e.acquire)
+}
+
+// 尝试加锁一次，不论是否为阻塞模式
+func (e *EtcdLock) TryLock(ctx context.Context) error {
+	return e.lock(ctx, e.tryLock)
+}
+
+// 创建会话并加锁，加锁失败时撤销会话租约
+func (e *EtcdLock) lock(ctx context.Context, acquire func(ctx context.Context, mutex *concurrency.Mutex) error) error {
+	if e.mutex != nil {
+		return fmt.Errorf("lock is held by current instance, err: %w", ErrLockAcquiredByOthers)
+	}
+	session, err := e.newSession(ctx)
+	if err != nil {
+		return err
+	}
+	mutex := concurrency.NewMutex(session, e.getLockKey())
+	if err := acquire(ctx, mutex); err != nil {
+		_ = session.Close()
+		return err
+	}
+	e.session, e.mutex = session, mutex
+	return nil
+}
+
+// 创建会话，未开启会话保活时不为租约续期，锁在 TTL 之后过期
+// 会话的保活跟随会话 ctx，因此 ctx 只在创建期间终止会话的创建，创建成功后锁的保活不受 ctx 影响
+func (e *EtcdLock) newSession(ctx context.Context) (*concurrency.Session, error) {
+	sessionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(int(e.expireSeconds)),
+		concurrency.WithContext(sessionCtx))
+	if !stop() {
+		// 创建期间 ctx 终止，撤销可能已经创建的租约，会话 ctx 已经终止，使用独立的 ctx 撤销
+		if err == nil {
+			session.Orphan()
+			revokeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(e.expireSeconds)*time.Second)
+			_, _ = e.client.Revoke(revokeCtx, session.Lease())
+			cancel()
+		}
+		return nil, fmt.Errorf("create session failed, err: %w", context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create session failed, err: %w", err)
+	}
+	if !e.keepAliveMode {
+		session.Orphan()
+	}
+	return session, nil
+}
+
+// 尝试取锁一次
+func (e *EtcdLock) tryLock(ctx context.Context, mutex *concurrency.Mutex) error {
+	err := mutex.TryLock(ctx)
+	if errors.Is(err, concurrency.ErrLocked) {
+		return fmt.Errorf("err: %v, %w", err, ErrLockAcquiredByOthers)
+	}
+	return err
+}
+
+// 加锁的通用流程，非阻塞模式只尝试取锁一次，阻塞模式在等锁时间上限内排队等锁
+func (e *EtcdLock) acquire(ctx context.Context, mutex *concurrency.Mutex) error {
+	if !e.blockMode {
+		return e.tryLock(ctx, mutex)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(e.blockWaitingSeconds)*time.Second)
+	defer cancel()
+	err := mutex.Lock(waitCtx)
+	if err == nil {
+		return nil
+	}
+	// ctx 终止了
+	if ctx.Err() != nil {
+		return fmt.Errorf("lock failed, ctx timeout, err: %w", ctx.Err())
+	}
+	// 阻塞等锁达到上限时间
+	if waitCtx.Err() != nil {
+		return fmt.Errorf("block waiting time out, err: %w", ErrLockAcquiredByOthers)
+	}
+	return err
+}
+
+// 为会话租约续期一次，将锁的过期时间刷新为 TTL，锁已不归属当前会话时返回 ErrLockNotOwned
+func (e *EtcdLock) Refresh(ctx context.Context) error {
+	if e.mutex == nil {
+		return fmt.Errorf("can not refresh without lock, err: %w", ErrLockNotOwned)
+	}
+	resp, err := e.client.Txn(ctx).If(e.mutex.IsOwner()).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("can not refresh, err: %w", ErrLockNotOwned)
+	}
+	if _, err := e.client.KeepAliveOnce(ctx, e.session.Lease()); err != nil {
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			return fmt.Errorf("can not refresh, err: %v, %w", err, ErrLockNotOwned)
+		}
+		return err
+	}
+	return nil
+}
+
+// 解锁，锁已经过期或者不归属当前会话时返回 ErrLockNotOwned
+func (e *EtcdLock) Unlock(ctx context.Context) error {
+	if e.mutex == nil {
+		return fmt.Errorf("can not unlock without lock, err: %w", ErrLockNotOwned)
+	}
+	session, mutex := e.session, e.mutex
+	e.session, e.mutex = nil, nil
+	// 撤销会话租约
+	defer session.Close()
+	// 校验持有者的 key 仍然存在，再删除
+	resp, err := e.client.Txn(ctx).If(mutex.IsOwner()).Then(clientv3.OpDelete(mutex.Key())).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("can not unlock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package etcd_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// 启动内嵌的 etcd 服务，返回连接该服务的客户端
+func newEmbedEtcdClient(t *testing.T) *clientv3.Client {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, _ := url.Parse("http://127.0.0.1:0")
+	peerURL, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls = []url.URL{*clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{*clientURL}
+	cfg.ListenPeerUrls = []url.URL{*peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("embed etcd server took too long to start")
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{e.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	return cli
+}
+
+// 阻塞分布式锁测试
+func Test_blockingLock(t *testing.T) {
+	client := newEmbedEtcdClient(t)
+	lock1 := NewEtcdLock("test_key", client)
+	lock2 := NewEtcdLock("test_key", client, ActiveBlockMode(), SetBlockWaitingSeconds(2))
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if err := lock1.Unlock(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := lock2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 非阻塞分布式锁
+func Test_nonblockingLock(t *testing.T) {
+	client := newEmbedEtcdClient(t)
+	lock1 := NewEtcdLock("test_key", client)
+	lock2 := NewEtcdLock("test_key", client)
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err == nil || !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	t.Log("success")
+}
+
+// 阻塞等锁达到上限时间
+func Test_blockingLockTimeout(t *testing.T) {
+	client := newEmbedEtcdClient(t)
+	lock1 := NewEtcdLock("test_timeout_key", client)
+	lock2 := NewEtcdLock("test_timeout_key", client, ActiveBlockMode(), SetBlockWaitingSeconds(1))
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 未开启会话保活时，锁在 TTL 之后过期；开启会话保活时，锁持续有效
+func Test_lockExpire(t *testing.T) {
+	client := newEmbedEtcdClient(t)
+	expiring := NewEtcdLock("test_expire_key", client, SetExpireSeconds(1))
+	keepAlive := NewEtcdLock("test_keep_alive_key", client, SetExpireSeconds(1), ActiveKeepAliveMode())
+	ctx := context.Background()
+	if err := expiring.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepAlive.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * time.Second)
+	other := NewEtcdLock("test_expire_key", client)
+	if err := other.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := expiring.Unlock(ctx); err == nil || !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := other.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepAlive.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// etcd 不可用时，创建会话随 ctx 终止；创建成功后，会话保活不受加锁 ctx 的影响
+func Test_lockCtx(t *testing.T) {
+	unavailable, err := clientv3.New(clientv3.Config{Endpoints: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unavailable.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := NewEtcdLock("test_ctx_key", unavailable).Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got err: %v, expect: %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("got elapsed: %v, expect lock to return once ctx is done", elapsed)
+	}
+
+	client := newEmbedEtcdClient(t)
+	keepAlive := NewEtcdLock("test_ctx_key", client, SetExpireSeconds(1), ActiveKeepAliveMode())
+	lockCtx, cancelLock := context.WithCancel(context.Background())
+	if err := keepAlive.Lock(lockCtx); err != nil {
+		t.Fatal(err)
+	}
+	cancelLock()
+	time.Sleep(3 * time.Second)
+	if err := NewEtcdLock("test_ctx_key", client).Lock(context.Background()); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := keepAlive.Unlock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
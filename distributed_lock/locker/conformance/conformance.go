@@ -0,0 +1,172 @@
+// 分布式锁一致性测试，每个 locker.LockFactory 的实现都需要通过
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"locker"
+)
+
+// 运行一致性测试，newFactory 为每个用例创建相互隔离的锁工厂
+func Run(t *testing.T, newFactory func(t *testing.T) locker.LockFactory) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, f locker.LockFactory)
+	}{
+		{"Exclusive", testExclusive},
+		{"UnlockNotOwned", testUnlockNotOwned},
+		{"Refresh", testRefresh},
+		{"TryLockInBlockMode", testTryLockInBlockMode},
+		{"BlockingLock", testBlockingLock},
+		{"BlockingLockTimeout", testBlockingLockTimeout},
+		{"Expire", testExpire},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.fn(t, newFactory(t))
+		})
+	}
+}
+
+func lockKey(t *testing.T) string {
+	return fmt.Sprintf("conformance_%s", t.Name())
+}
+
+func expectErr(t *testing.T, err, target error) {
+	t.Helper()
+	if err == nil || !errors.Is(err, target) {
+		t.Errorf("got err: %v, expect: %v", err, target)
+	}
+}
+
+// 同一时刻只有一个持有者
+func testExclusive(t *testing.T, f locker.LockFactory) {
+	lock1 := f.NewLock(lockKey(t))
+	lock2 := f.NewLock(lockKey(t))
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, lock2.Lock(ctx), locker.ErrLockAcquiredByOthers)
+	expectErr(t, lock2.TryLock(ctx), locker.ErrLockAcquiredByOthers)
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.TryLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 未持有锁时不能解锁
+func testUnlockNotOwned(t *testing.T, f locker.LockFactory) {
+	lock1 := f.NewLock(lockKey(t))
+	lock2 := f.NewLock(lockKey(t))
+	ctx := context.Background()
+	expectErr(t, lock1.Unlock(ctx), locker.ErrLockNotOwned)
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, lock2.Unlock(ctx), locker.ErrLockNotOwned)
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, lock1.Unlock(ctx), locker.ErrLockNotOwned)
+}
+
+// 持有锁时可以续期，解锁后续期失败
+func testRefresh(t *testing.T, f locker.LockFactory) {
+	lock := f.NewLock(lockKey(t), locker.SetExpireSeconds(5))
+	ctx := context.Background()
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, lock.Refresh(ctx), locker.ErrLockNotOwned)
+}
+
+// 阻塞模式下 TryLock 也只尝试一次
+func testTryLockInBlockMode(t *testing.T, f locker.LockFactory) {
+	holder := f.NewLock(lockKey(t))
+	waiter := f.NewLock(lockKey(t), locker.ActiveBlockMode(), locker.SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	expectErr(t, waiter.TryLock(ctx), locker.ErrLockAcquiredByOthers)
+	if cost := time.Since(start); cost >= time.Second {
+		t.Errorf("got cost: %v, expect TryLock returns without waiting", cost)
+	}
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 阻塞模式下等待其他持有者释放锁
+func testBlockingLock(t *testing.T, f locker.LockFactory) {
+	holder := f.NewLock(lockKey(t))
+	waiter := f.NewLock(lockKey(t), locker.ActiveBlockMode(), locker.SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(200 * time.Millisecond)
+		if err := holder.Unlock(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := waiter.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-released
+	if err := waiter.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 阻塞等锁达到上限时间
+func testBlockingLockTimeout(t *testing.T, f locker.LockFactory) {
+	holder := f.NewLock(lockKey(t))
+	waiter := f.NewLock(lockKey(t), locker.ActiveBlockMode(), locker.SetBlockWaitingSeconds(1))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, waiter.Lock(ctx), locker.ErrLockAcquiredByOthers)
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 锁过期后可以被其他持有者获取，原持有者不能再解锁或者续期
+func testExpire(t *testing.T, f locker.LockFactory) {
+	lock1 := f.NewLock(lockKey(t), locker.SetExpireSeconds(1))
+	lock2 := f.NewLock(lockKey(t), locker.ActiveBlockMode(), locker.SetBlockWaitingSeconds(5))
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, lock1.Refresh(ctx), locker.ErrLockNotOwned)
+	expectErr(t, lock1.Unlock(ctx), locker.ErrLockNotOwned)
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+package etcd_locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"etcd_distributed_lock"
+	"locker"
+)
+
+// 基于 etcd 的分布式锁工厂，每个锁实例持有独立的会话
+type Factory struct {
+	client *clientv3.Client
+	// 额外的 etcd 锁配置，例如会话保活
+	opts []etcd_distributed_lock.LockOption
+}
+
+func NewFactory(client *clientv3.Client, opts ...etcd_distributed_lock.LockOption) *Factory {
+	return &Factory{
+		client: client,
+		opts:   opts,
+	}
+}
+
+func (f *Factory) NewLock(key string, opts ...locker.LockOption) locker.Locker {
+	o := locker.NewLockOptions(opts...)
+	var lockOpts []etcd_distributed_lock.LockOption
+	if o.BlockMode {
+		lockOpts = append(lockOpts, etcd_distributed_lock.ActiveBlockMode(),
+			etcd_distributed_lock.SetBlockWaitingSeconds(o.BlockWaitingSeconds))
+	}
+	if o.ExpireSeconds > 0 {
+		lockOpts = append(lockOpts, etcd_distributed_lock.SetExpireSeconds(o.ExpireSeconds))
+	}
+	lockOpts = append(lockOpts, f.opts...)
+	return &etcdLocker{lock: etcd_distributed_lock.NewEtcdLock(key, f.client, lockOpts...)}
+}
+
+// 将 EtcdLock 的错误转换为 locker 的错误
+type etcdLocker struct {
+	lock *etcd_distributed_lock.EtcdLock
+}
+
+func (e *etcdLocker) Lock(ctx context.Context) error {
+	return wrapErr(e.lock.Lock(ctx))
+}
+
+func (e *etcdLocker) TryLock(ctx context.Context) error {
+	return wrapErr(e.lock.TryLock(ctx))
+}
+
+func (e *etcdLocker) Unlock(ctx context.Context) error {
+	return wrapErr(e.lock.Unlock(ctx))
+}
+
+func (e *etcdLocker) Refresh(ctx context.Context) error {
+	return wrapErr(e.lock.Refresh(ctx))
+}
+
+func wrapErr(err error) error {
+	switch {
+	case errors.Is(err, etcd_distributed_lock.ErrLockAcquiredByOthers):
+		return fmt.Errorf("%w, err: %w", locker.ErrLockAcquiredByOthers, err)
+	case errors.Is(err, etcd_distributed_lock.ErrLockNotOwned):
+		return fmt.Errorf("%w, err: %w", locker.ErrLockNotOwned, err)
+	default:
+		return err
+	}
+}
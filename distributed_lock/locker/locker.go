@@ -0,0 +1,70 @@
+package locker
+
+import (
+	"context"
+	"errors"
+)
+
+// 加锁失败，锁被其他持有者持有
+var ErrLockAcquiredByOthers = errors.New("lock is acquired by others")
+
+// 解锁或者续期失败，锁已经过期或者不归属当前持有者
+var ErrLockNotOwned = errors.New("lock is not owned by current holder")
+
+// 与存储后端无关的分布式锁，每个 Locker 实例是一个独立的持有者
+type Locker interface {
+	// 加锁，阻塞模式下会在等锁时间上限内等待其他持有者释放锁
+	Lock(ctx context.Context) error
+	// 尝试加锁一次，不论是否为阻塞模式
+	TryLock(ctx context.Context) error
+	// 解锁，锁已不归属当前持有者时返回 ErrLockNotOwned
+	Unlock(ctx context.Context) error
+	// 将锁的过期时间刷新为配置的过期时间，锁已不归属当前持有者时返回 ErrLockNotOwned
+	Refresh(ctx context.Context) error
+}
+
+// 分布式锁工厂，不同的存储后端提供各自的实现，切换后端只需要替换工厂
+type LockFactory interface {
+	NewLock(key string, opts ...LockOption) Locker
+}
+
+// 锁配置
+type LockOptions struct {
+	BlockMode           bool
+	BlockWaitingSeconds int64
+	// 未设置时由存储后端使用默认的过期时间，并在持有锁期间自动续期
+	ExpireSeconds int64
+}
+
+type LockOption func(*LockOptions)
+
+func ActiveBlockMode() LockOption {
+	return func(o *LockOptions) {
+		o.BlockMode = true
+	}
+}
+
+func SetBlockWaitingSeconds(bws int64) LockOption {
+	return func(o *LockOptions) {
+		o.BlockWaitingSeconds = bws
+	}
+}
+
+func SetExpireSeconds(es int64) LockOption {
+	return func(o *LockOptions) {
+		o.ExpireSeconds = es
+	}
+}
+
+// 应用锁配置，供存储后端的实现使用
+func NewLockOptions(opts ...LockOption) LockOptions {
+	var o LockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func IsRetryableErr(err error) bool {
+	return errors.Is(err, ErrLockAcquiredByOthers)
+}
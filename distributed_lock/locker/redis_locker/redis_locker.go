@@ -0,0 +1,70 @@
+package redis_locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"locker"
+	"redis_distributed_lock"
+)
+
+// 基于 redis 的分布式锁工厂
+type Factory struct {
+	client redis_distributed_lock.LockClient
+	// 额外的 redis 锁配置，例如公平模式
+	opts []redis_distributed_lock.LockOption
+}
+
+func NewFactory(client redis_distributed_lock.LockClient, opts ...redis_distributed_lock.LockOption) *Factory {
+	return &Factory{
+		client: client,
+		opts:   opts,
+	}
+}
+
+func (f *Factory) NewLock(key string, opts ...locker.LockOption) locker.Locker {
+	o := locker.NewLockOptions(opts...)
+	var lockOpts []redis_distributed_lock.LockOption
+	if o.BlockMode {
+		lockOpts = append(lockOpts, redis_distributed_lock.ActiveBlockMode(),
+			redis_distributed_lock.SetBlockWaitingSeconds(o.BlockWaitingSeconds))
+	}
+	if o.ExpireSeconds > 0 {
+		lockOpts = append(lockOpts, redis_distributed_lock.SetExpireSeconds(o.ExpireSeconds))
+	}
+	lockOpts = append(lockOpts, f.opts...)
+	return &redisLocker{lock: redis_distributed_lock.NewRedisLock(key, f.client, lockOpts...)}
+}
+
+// 将 RedisLock 的错误转换为 locker 的错误
+type redisLocker struct {
+	lock *redis_distributed_lock.RedisLock
+}
+
+func (r *redisLocker) Lock(ctx context.Context) error {
+	return wrapErr(r.lock.Lock(ctx))
+}
+
+func (r *redisLocker) TryLock(ctx context.Context) error {
+	return wrapErr(r.lock.TryLock(ctx))
+}
+
+func (r *redisLocker) Unlock(ctx context.Context) error {
+	return wrapErr(r.lock.Unlock(ctx))
+}
+
+func (r *redisLocker) Refresh(ctx context.Context) error {
+	return wrapErr(r.lock.Refresh(ctx))
+}
+
+func wrapErr(err error) error {
+	switch {
+	case errors.Is(err, redis_distributed_lock.ErrLockAcquiredByOthers):
+		return fmt.Errorf("%w, err: %w", locker.ErrLockAcquiredByOthers, err)
+	case errors.Is(err, redis_distributed_lock.ErrLockNotOwned):
+		return fmt.Errorf("%w, err: %w", locker.ErrLockNotOwned, err)
+	default:
+		return err
+	}
+}
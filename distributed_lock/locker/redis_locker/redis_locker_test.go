@@ -0,0 +1,20 @@
+package redis_locker
+
+import (
+	"testing"
+
+	"locker"
+	"locker/conformance"
+	"redis_distributed_lock/redistest"
+)
+
+func Test_conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) locker.LockFactory {
+		client, err := redistest.NewMemoryClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return NewFactory(client)
+	})
+}
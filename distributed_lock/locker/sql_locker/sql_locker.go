@@ -0,0 +1,202 @@
+package sql_locker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"locker"
+)
+
+// 默认配置参数
+const (
+	// 默认锁表名
+	DefaultTableName = "distributed_lock"
+	// 默认阻塞时间
+	DefaultBlockWaitingSeconds = 5
+	// 默认分布式锁过期时间
+	DefaultDistributedLockExpireSeconds = 30
+	// 看门狗工作间隔时间
+	DefaultWatchDogStepSeconds = 10
+	// 阻塞模式下轮询取锁的时间间隔
+	DefaultPollInterval = 50 * time.Millisecond
+)
+
+// 锁实例序号，保证每个 Locker 实例是一个独立的持有者
+var lockSeq int64
+
+// 基于关系型数据库的分布式锁工厂，锁记录在一张以 lock_key 为主键的表中
+// 过期时间基于应用服务器的时钟计算，各服务器之间需要保证时钟同步
+// sql 语句使用 ? 作为占位符，适用于 MySQL 和 SQLite
+type Factory struct {
+	db    *sql.DB
+	table string
+}
+
+// 初始化，table 为空时使用默认锁表名
+func NewFactory(db *sql.DB, table string) *Factory {
+	if table == "" {
+		table = DefaultTableName
+	}
+	return &Factory{
+		db:    db,
+		table: table,
+	}
+}
+
+// 创建锁表
+func (f *Factory) CreateTable(ctx context.Context) error {
+	_, err := f.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	lock_key VARCHAR(255) NOT NULL PRIMARY KEY,
+	token VARCHAR(255) NOT NULL,
+	expire_at BIGINT NOT NULL
+)`, f.table))
+	return err
+}
+
+func (f *Factory) NewLock(key string, opts ...locker.LockOption) locker.Locker {
+	s := SQLLock{
+		LockOptions: locker.NewLockOptions(opts...),
+		db:          f.db,
+		table:       f.table,
+		key:         key,
+		token:       fmt.Sprintf("%d_%d", time.Now().UnixNano(), atomic.AddInt64(&lockSeq, 1)),
+	}
+	if s.BlockMode && s.BlockWaitingSeconds <= 0 {
+		s.BlockWaitingSeconds = DefaultBlockWaitingSeconds
+	}
+	// 用户未显式指定锁的过期时间，则会启动看门狗
+	if s.ExpireSeconds <= 0 {
+		s.ExpireSeconds = DefaultDistributedLockExpireSeconds
+		s.watchDogMode = true
+	}
+	return &s
+}
+
+// 基于关系型数据库的分布式锁
+type SQLLock struct {
+	locker.LockOptions
+	db    *sql.DB
+	table string
+	key   string
+	token string
+	// 看门狗
+	watchDogMode bool
+	cancel       context.CancelFunc
+}
+
+// 加锁
+func (s *SQLLock) Lock(ctx context.Context) error {
+	err := s.tryLock(ctx)
+	if err == nil || !s.BlockMode || !locker.IsRetryableErr(err) {
+		return s.afterLock(ctx, err)
+	}
+	// 基于阻塞模式持续轮询取锁
+	timeoutCh := time.After(time.Duration(s.BlockWaitingSeconds) * time.Second)
+	ticker := time.NewTicker(DefaultPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		// ctx 终止了
+		case <-ctx.Done():
+			return fmt.Errorf("lock failed, ctx timeout, err: %w", ctx.Err())
+		// 阻塞等锁达到上限时间
+		case <-timeoutCh:
+			return fmt.Errorf("block waiting time out, err: %w", locker.ErrLockAcquiredByOthers)
+		case <-ticker.C:
+		}
+		err := s.tryLock(ctx)
+		if err == nil || !locker.IsRetryableErr(err) {
+			return s.afterLock(ctx, err)
+		}
+	}
+}
+
+// 尝试加锁一次，不论是否为阻塞模式
+func (s *SQLLock) TryLock(ctx context.Context) error {
+	return s.afterLock(ctx, s.tryLock(ctx))
+}
+
+// 加锁成功的情况下，会启动看门狗
+func (s *SQLLock) afterLock(ctx context.Context, err error) error {
+	if err != nil || !s.watchDogMode {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	go s.watchDog(ctx)
+	return nil
+}
+
+// 尝试获取锁，先清理已经过期的锁，再插入锁记录
+func (s *SQLLock) tryLock(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE lock_key = ? AND expire_at <= ?", s.table),
+		s.key, now); err != nil {
+		return err
+	}
+	expireAt := now + s.ExpireSeconds*1000
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (lock_key, token, expire_at) VALUES (?, ?, ?)", s.table),
+		s.key, s.token, expireAt)
+	if err == nil {
+		return nil
+	}
+	// 插入失败时，锁记录存在说明锁被其他持有者持有
+	var count int64
+	if qErr := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE lock_key = ?", s.table),
+		s.key).Scan(&count); qErr == nil && count > 0 {
+		return fmt.Errorf("err: %v, %w", err, locker.ErrLockAcquiredByOthers)
+	}
+	return err
+}
+
+// 看门狗，持续为锁续期，直到解锁或者锁已不归属自己
+func (s *SQLLock) watchDog(ctx context.Context) {
+	ticker := time.NewTicker(DefaultWatchDogStepSeconds * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Refresh(ctx); errors.Is(err, locker.ErrLockNotOwned) {
+			return
+		}
+	}
+}
+
+// 将锁的过期时间刷新为 ExpireSeconds
+func (s *SQLLock) Refresh(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	result, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET expire_at = ? WHERE lock_key = ? AND token = ? AND expire_at > ?", s.table),
+		now+s.ExpireSeconds*1000, s.key, s.token, now)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("can not expire lock, err: %w", locker.ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 解锁
+func (s *SQLLock) Unlock(ctx context.Context) error {
+	// 停止看门狗
+	if s.cancel != nil {
+		s.cancel()
+	}
+	result, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE lock_key = ? AND token = ? AND expire_at > ?", s.table),
+		s.key, s.token, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("can not unlock, err: %w", locker.ErrLockNotOwned)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package sql_locker
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"locker"
+	"locker/conformance"
+)
+
+func Test_conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) locker.LockFactory {
+		db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "lock.db")+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		f := NewFactory(db, "")
+		if err := f.CreateTable(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	})
+}
@@ -0,0 +1,306 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var ErrLockNotFound = errors.New("lock is not found")
+
+// 锁的类型
+const (
+	// 独占锁，包括公平锁以及读写锁中的写锁
+	LockKindExclusive = "exclusive"
+	// 可重入锁
+	LockKindReentrant = "reentrant"
+	// 读写锁中的读锁、信号量，可以被多个持有者同时持有
+	LockKindShared = "shared"
+)
+
+// 锁变化事件的类型
+const (
+	LockEventAcquired = "acquired"
+	LockEventChanged  = "changed"
+	LockEventReleased = "released"
+)
+
+// 锁的派生 key 的后缀以及对应的 redis 类型，列出锁时跳过派生 key
+// 只凭后缀无法区分派生 key 与恰好以该后缀结尾的锁，例如 order_QUEUE，因此还需要通过 LuaIsDerivedKey 核实
+var derivedKeyTypes = []struct {
+	suffix  string
+	keyType string
+}{
+	{"_FENCE", "string"},
+	{"_QUEUE", "zset"},
+	{"_QUEUE_TIMEOUT", "zset"},
+	{"_WRITERS", "zset"},
+	{"_META", "hash"},
+	// SingleFlight 的计算结果以及 DoOnce 的执行成功标记
+	{"_RESULT", "string"},
+	{"_DONE", "string"},
+}
+
+// 锁的持有者
+type LockOwner struct {
+	Token string `json:"token"`
+	// 可重入锁的重入次数
+	Count int64 `json:"count,omitempty"`
+	// 读锁、信号量持有者的剩余租约（毫秒）
+	LeaseMillis int64 `json:"lease_ms,omitempty"`
+}
+
+// 锁的状态
+type LockInfo struct {
+	// 锁的 key，不含前缀以及命名空间，以哈希标签包裹的 key 包含哈希标签
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	// 剩余过期时间（毫秒），-1 表示没有设置过期时间
+	TTLMillis int64       `json:"ttl_ms"`
+	Owners    []LockOwner `json:"owners"`
+	// 加锁时通过 SetLockMetadata 记录的持有者元数据，未记录时为 nil
+	Metadata *LockMetadata `json:"metadata,omitempty"`
+}
+
+// 锁变化事件
+type LockEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Lock LockInfo  `json:"lock"`
+}
+
+// 列出 key 匹配 pattern 的锁，pattern 为不含前缀以及命名空间的 glob 表达式，例如 order_*
+// 通过 SetKeyPrefix、SetNamespace 指定锁所在的前缀、命名空间，未指定时列出 LockKeyPrefix 下的锁
+// 通过 SCAN 遍历，不会阻塞 redis，但遍历期间变化的锁可能被遗漏
+func (c *Client) ListLocks(ctx context.Context, pattern string, opts ...LockOption) ([]LockInfo, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	space := adminKeySpace(opts)
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	seen := make(map[string]struct{})
+	var keys []string
+	cursor := 0
+	for {
+		reply, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", cursor, "MATCH", space+pattern, "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+		var batch []string
+		if _, err := redis.Scan(reply, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		for _, key := range batch {
+			key = strings.TrimPrefix(key, space)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			derived, err := c.isDerivedKey(ctx, space, key)
+			if err != nil {
+				return nil, err
+			}
+			if !derived {
+				keys = append(keys, key)
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(keys)
+	infos := make([]LockInfo, 0, len(keys))
+	for _, key := range keys {
+		info, err := c.Inspect(ctx, key, opts...)
+		// 遍历期间已经释放的锁
+		if errors.Is(err, ErrLockNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// 查看一个锁的持有者、剩余过期时间以及持有者的元数据，锁不存在时返回 ErrLockNotFound
+// key 不含前缀以及命名空间，与 ListLocks 返回的 key 相同，前缀、命名空间通过 SetKeyPrefix、SetNamespace 指定
+func (c *Client) Inspect(ctx context.Context, key string, opts ...LockOption) (*LockInfo, error) {
+	if key == "" {
+		return nil, errors.New("lock key can't be empty")
+	}
+	lockKey := adminKeySpace(opts) + key
+	keys := []interface{}{lockKey, lockKey + "_META"}
+	reply, err := redis.Values(c.Eval(ctx, LuaInspectLock, 2, keys))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 {
+		return nil, fmt.Errorf("can not inspect lock %s, err: %w", key, ErrLockNotFound)
+	}
+	var keyType string
+	var pttl, nowMillis int64
+	var owners, metadata []string
+	if _, err := redis.Scan(reply, &keyType, &pttl, &nowMillis, &owners, &metadata); err != nil {
+		return nil, err
+	}
+	info := LockInfo{Key: key, TTLMillis: pttl, Owners: []LockOwner{}}
+	switch keyType {
+	case "string":
+		info.Kind = LockKindExclusive
+	case "hash":
+		info.Kind = LockKindReentrant
+	case "zset":
+		info.Kind = LockKindShared
+	default:
+		return nil, fmt.Errorf("key %s of type %s is not a lock", key, keyType)
+	}
+	for i := 0; i+1 < len(owners); i += 2 {
+		owner := LockOwner{Token: owners[i]}
+		value, _ := strconv.ParseFloat(owners[i+1], 64)
+		switch info.Kind {
+		case LockKindReentrant:
+			owner.Count = int64(value)
+		case LockKindShared:
+			// 租约已过期但尚未被清理的持有者
+			if owner.LeaseMillis = int64(value) - nowMillis; owner.LeaseMillis <= 0 {
+				continue
+			}
+		}
+		info.Owners = append(info.Owners, owner)
+	}
+	// 只返回属于当前持有者的元数据
+	if m := parseLockMetadata(metadata); m != nil {
+		for _, owner := range info.Owners {
+			if owner.Token == m.Token {
+				info.Metadata = m
+				break
+			}
+		}
+	}
+	return &info, nil
+}
+
+// 强制释放锁，不校验持有者，用于运维处理卡住的锁，并通知等锁者重新取锁
+// 原持有者不会感知到锁被释放，直到续期失败，调用前需要确认原持有者已经不再访问共享资源
+func (c *Client) ForceRelease(ctx context.Context, key string, opts ...LockOption) error {
+	if key == "" {
+		return errors.New("lock key can't be empty")
+	}
+	space := adminKeySpace(opts)
+	// 读锁持有者记录在 xxx_READERS 中，与写锁共用通知频道
+	channel := space + strings.TrimSuffix(key, "_READERS") + "_CHANNEL"
+	keysAndArgs := []interface{}{space + key, space + key + "_META", channel}
+	reply, err := c.Eval(ctx, LuaForceRelease, 2, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not release lock %s, err: %w", key, ErrLockNotFound)
+	}
+	return nil
+}
+
+// 每隔 interval 列出一次匹配 pattern 的锁，与上一次的结果比较，锁被持有、持有者变化、锁被释放时调用 onEvent
+// 首次列出的锁均作为 acquired 事件，ctx 终止或 onEvent 返回错误时退出
+func (c *Client) WatchLocks(ctx context.Context, pattern string, interval time.Duration,
+	onEvent func(event LockEvent) error, opts ...LockOption) error {
+	if interval <= 0 {
+		return errors.New("watch interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := make(map[string]LockInfo)
+	for {
+		infos, err := c.ListLocks(ctx, pattern, opts...)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		current := make(map[string]LockInfo, len(infos))
+		for _, info := range infos {
+			current[info.Key] = info
+			prev, ok := last[info.Key]
+			switch {
+			case !ok:
+				err = onEvent(LockEvent{Type: LockEventAcquired, Time: now, Lock: info})
+			case !sameOwners(prev, info):
+				err = onEvent(LockEvent{Type: LockEventChanged, Time: now, Lock: info})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for key, prev := range last {
+			if _, ok := current[key]; ok {
+				continue
+			}
+			prev.Owners, prev.TTLMillis = []LockOwner{}, 0
+			if err := onEvent(LockEvent{Type: LockEventReleased, Time: now, Lock: prev}); err != nil {
+				return err
+			}
+		}
+		last = current
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// 管理锁时使用的前缀以及命名空间，哈希标签不生效，key 中需要包含哈希标签
+func adminKeySpace(opts []LockOption) string {
+	var o LockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.keySpace()
+}
+
+// 是否为锁的派生 key：以派生 key 的后缀结尾、类型与派生 key 一致，本身没有作为锁加过锁，
+// 并且去掉后缀后的锁存在或者曾经加过锁
+func (c *Client) isDerivedKey(ctx context.Context, space, key string) (bool, error) {
+	for _, derived := range derivedKeyTypes {
+		base, ok := strings.CutSuffix(key, derived.suffix)
+		if !ok {
+			continue
+		}
+		keys := []interface{}{space + key, space + key + "_FENCE", space + base, space + base + "_FENCE",
+			space + base + "_READERS", derived.keyType}
+		ret, err := redis.Int64(c.Eval(ctx, LuaIsDerivedKey, 5, keys))
+		if err != nil {
+			return false, err
+		}
+		return ret == 1, nil
+	}
+	return false, nil
+}
+
+// 持有者是否相同，忽略剩余租约
+func sameOwners(a, b LockInfo) bool {
+	if a.Kind != b.Kind || len(a.Owners) != len(b.Owners) {
+		return false
+	}
+	tokens := make(map[string]int64, len(a.Owners))
+	for _, owner := range a.Owners {
+		tokens[owner.Token] = owner.Count
+	}
+	for _, owner := range b.Owners {
+		if count, ok := tokens[owner.Token]; !ok || count != owner.Count {
+			return false
+		}
+	}
+	return true
+}
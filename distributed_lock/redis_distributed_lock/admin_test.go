@@ -0,0 +1,208 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// 列出、查看各种类型的锁
+func Test_listLocks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	locks := []interface {
+		Lock(ctx context.Context) error
+	}{
+		NewRedisLock("order_1", client, SetOwnerToken("token_1"), SetExpireSeconds(10)),
+		NewRedisLock("order_2", client, SetOwnerToken("token_2"), SetExpireSeconds(10), ActiveReentrantMode()),
+		NewRedisLock("order_3", client, SetOwnerToken("token_3"), SetExpireSeconds(10), ActiveFairMode()),
+		NewRedisLock("user_1", client, SetOwnerToken("token_4"), SetExpireSeconds(10)),
+	}
+	for _, l := range locks {
+		if err := l.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := locks[1].Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRedisRWLock("order_4", client, SetOwnerToken("token_5"), SetExpireSeconds(10)).RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := client.ListLocks(ctx, "order_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []struct {
+		key   string
+		kind  string
+		token string
+		count int64
+	}{
+		{"order_1", LockKindExclusive, "token_1", 0},
+		{"order_2", LockKindReentrant, "token_2", 2},
+		{"order_3", LockKindExclusive, "token_3", 0},
+		{"order_4_READERS", LockKindShared, "token_5", 0},
+	}
+	if len(infos) != len(expects) {
+		t.Fatalf("got locks: %+v, expect: %d", infos, len(expects))
+	}
+	for i, expect := range expects {
+		info := infos[i]
+		if info.Key != expect.key || info.Kind != expect.kind || len(info.Owners) != 1 ||
+			info.Owners[0].Token != expect.token || info.Owners[0].Count != expect.count {
+			t.Errorf("got lock: %+v, expect: %+v", info, expect)
+		}
+		if info.TTLMillis <= 0 || info.TTLMillis > 10000 {
+			t.Errorf("got ttl of %s: %d", info.Key, info.TTLMillis)
+		}
+	}
+	if lease := infos[3].Owners[0].LeaseMillis; lease <= 0 || lease > 10000 {
+		t.Errorf("got lease: %d", lease)
+	}
+
+	if _, err := client.Inspect(ctx, "order_5"); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotFound)
+	}
+	t.Log("success")
+}
+
+// 以派生 key 的后缀结尾的锁同样会被列出，锁的派生 key 不会被列出
+func Test_listLocksWithDerivedSuffix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	locks := []interface {
+		Lock(ctx context.Context) error
+	}{
+		NewRedisLock("job", client, SetOwnerToken("token_1"), SetExpireSeconds(10), SetLockMetadata(LockMetadata{Service: "svc"})),
+		NewRedisLock("task_QUEUE", client, SetOwnerToken("token_2"), SetExpireSeconds(10)),
+		NewRedisLock("report_META", client, SetOwnerToken("token_3"), SetExpireSeconds(10), ActiveReentrantMode()),
+		NewRedisRWLock("task_FENCE", client, SetOwnerToken("token_4"), SetExpireSeconds(10)),
+	}
+	for _, l := range locks {
+		if err := l.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := client.ListLocks(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	// job_FENCE、job_META 是 job 的派生 key
+	expects := []string{"job", "report_META", "task_FENCE", "task_QUEUE"}
+	if len(keys) != len(expects) {
+		t.Fatalf("got locks: %v, expect: %v", keys, expects)
+	}
+	for i, key := range expects {
+		if keys[i] != key {
+			t.Errorf("got locks: %v, expect: %v", keys, expects)
+			break
+		}
+	}
+	t.Log("success")
+}
+
+// 强制释放锁后，等锁者被唤醒并取到锁
+func Test_forceRelease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	holder := NewRedisLock("stuck", client, SetOwnerToken("holder"), SetExpireSeconds(30))
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waiter := NewRedisLock("stuck", client, SetOwnerToken("waiter"), SetExpireSeconds(30),
+		ActiveBlockMode(), SetBlockWaitingSeconds(5))
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- waiter.Lock(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := client.ForceRelease(ctx, "stuck"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// 通过锁释放通知唤醒，无需等到兜底轮询
+	if cost := time.Since(start); cost >= 100*time.Millisecond+DefaultReleaseFallbackPollInterval {
+		t.Errorf("waiter acquired lock after %v", cost)
+	}
+	info, err := client.Inspect(ctx, "stuck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Owners[0].Token != "waiter" {
+		t.Errorf("got owner: %s, expect: waiter", info.Owners[0].Token)
+	}
+	if err := holder.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := client.ForceRelease(ctx, "missing"); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotFound)
+	}
+	t.Log("success")
+}
+
+// 观察锁的持有、持有者变化以及释放
+func Test_watchLocks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan LockEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WatchLocks(ctx, "*", 20*time.Millisecond, func(event LockEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+	next := func() LockEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("no lock event")
+			return LockEvent{}
+		}
+	}
+
+	first := NewRedisLock("watched", client, SetOwnerToken("first"), SetExpireSeconds(10))
+	if err := first.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(); event.Type != LockEventAcquired || event.Lock.Owners[0].Token != "first" {
+		t.Errorf("got event: %+v, expect acquired by first", event)
+	}
+	// 原子地替换持有者，避免两次轮询之间观察到锁被释放
+	if err := mr.Set(LockKeyPrefix+"watched", "second"); err != nil {
+		t.Fatal(err)
+	}
+	second := NewRedisLock("watched", client, SetOwnerToken("second"))
+	if event := next(); event.Type != LockEventChanged || event.Lock.Owners[0].Token != "second" {
+		t.Errorf("got event: %+v, expect changed to second", event)
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(); event.Type != LockEventReleased || event.Lock.Key != "watched" {
+		t.Errorf("got event: %+v, expect released", event)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got err: %v, expect: %v", err, context.Canceled)
+	}
+	t.Log("success")
+}
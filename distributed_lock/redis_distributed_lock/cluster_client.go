@@ -0,0 +1,310 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redis cluster 的哈希槽数量
+const clusterSlots = 16384
+
+// 单个命令最多跟随的重定向次数
+const clusterMaxRedirects = 5
+
+// redis cluster 客户端，按照 key 的哈希槽将命令路由到对应的主节点，并跟随 MOVED、ASK 重定向
+// lua 脚本的所有 key 需要位于同一个哈希槽，因此锁的 key 需要包含哈希标签，例如 NewRedisLock("{order_1}", ...)，
+// 或者通过 ActiveHashTag 自动包裹，这样锁 key 以及 _FENCE、_QUEUE 等派生 key 都会路由到同一个节点
+type ClusterClient struct {
+	ClientOptions
+	startupAddrs []string
+	mu           sync.RWMutex
+	// 哈希槽 -> 主节点地址
+	slots [clusterSlots]string
+	// 主节点地址 -> 该节点的客户端
+	nodes map[string]*Client
+}
+
+// 创建一个redis cluster客户端，addrs 为部分集群节点的地址，用于发现集群的哈希槽分布
+func NewClusterClient(addrs []string, password string, opts ...ClientOption) *ClusterClient {
+	c := ClusterClient{
+		ClientOptions: ClientOptions{
+			network:  "tcp",
+			password: password,
+		},
+		startupAddrs: append([]string(nil), addrs...),
+		nodes:        make(map[string]*Client),
+	}
+	for _, opt := range opts {
+		opt(&c.ClientOptions)
+	}
+	checkClientOptions(&c.ClientOptions)
+	return &c
+}
+
+// get key
+func (c *ClusterClient) Get(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("redis GET key can't be empty")
+	}
+	return redis.String(c.do(ctx, key, "GET", key))
+}
+
+// set nex
+func (c *ClusterClient) SetNEX(ctx context.Context, key, value string, expiredSeconds int64) (int64, error) {
+	if key == "" || value == "" {
+		return -1, errors.New("redis SET key or value can't be empty")
+	}
+	reply, err := c.do(ctx, key, "SET", key, value, "EX", expiredSeconds, "NX")
+	if err != nil {
+		return -1, err
+	}
+	if resp, ok := reply.(string); ok && strings.ToLower(resp) == "ok" {
+		return 1, nil
+	}
+	// key 已存在时 NX 返回 nil
+	if reply == nil {
+		return 0, nil
+	}
+	return redis.Int64(reply, err)
+}
+
+// del key
+func (c *ClusterClient) Del(ctx context.Context, key string) error {
+	if key == "" {
+		return errors.New("redis DEL key can't be empty")
+	}
+	_, err := c.do(ctx, key, "DEL", key)
+	return err
+}
+
+// lua script，所有 key 需要位于同一个哈希槽，通过 EVALSHA 执行，节点未缓存脚本时回退到 EVAL
+func (c *ClusterClient) Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error) {
+	if keyCount < 0 || keyCount > len(keysAndArgs) {
+		return nil, fmt.Errorf("invalid key count: %d", keyCount)
+	}
+	var key string
+	for i := 0; i < keyCount; i++ {
+		k := fmt.Sprint(keysAndArgs[i])
+		if i == 0 {
+			key = k
+			continue
+		}
+		if keySlot(k) != keySlot(key) {
+			return nil, fmt.Errorf("keys %s and %s of lua script are in different slots, use hash tags like {key}", key, k)
+		}
+	}
+	return evalSha(src, keyCount, keysAndArgs, func(cmd string, args ...interface{}) (interface{}, error) {
+		return c.do(ctx, key, cmd, args...)
+	})
+}
+
+// 监听 pub/sub 频道，集群中 PUBLISH 的消息会广播到所有节点，因此在频道所在哈希槽的节点上订阅即可
+func (c *ClusterClient) ListenPubSubChannels(ctx context.Context,
+	onStart func() error,
+	onMessage func(channel string, data []byte) error,
+	channels ...string) error {
+	if len(channels) == 0 {
+		return errors.New("no channel to subscribe")
+	}
+	addr, err := c.slotAddr(ctx, keySlot(channels[0]))
+	if err != nil {
+		return err
+	}
+	return c.node(addr).ListenPubSubChannels(ctx, onStart, onMessage, channels...)
+}
+
+// 在 key 所在的节点上执行命令，跟随 MOVED、ASK 重定向
+func (c *ClusterClient) do(ctx context.Context, key, cmd string, args ...interface{}) (interface{}, error) {
+	addr, err := c.slotAddr(ctx, keySlot(key))
+	if err != nil {
+		return nil, err
+	}
+	var asking bool
+	for i := 0; i <= clusterMaxRedirects; i++ {
+		reply, err := c.node(addr).doAsking(ctx, asking, cmd, args...)
+		moved, target, ok := parseRedirect(err)
+		if !ok {
+			return reply, err
+		}
+		// MOVED 说明哈希槽已经迁移完成，需要刷新哈希槽分布；ASK 说明哈希槽正在迁移，只重定向本次命令
+		asking = !moved
+		if moved {
+			_ = c.refreshSlots(ctx)
+		}
+		addr = target
+	}
+	return nil, fmt.Errorf("too many redirects for key: %s", key)
+}
+
+// 哈希槽所在的节点地址，尚未加载哈希槽分布时先加载
+func (c *ClusterClient) slotAddr(ctx context.Context, slot int) (string, error) {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr != "" {
+		return addr, nil
+	}
+	if err := c.refreshSlots(ctx); err != nil {
+		return "", err
+	}
+	c.mu.RLock()
+	addr = c.slots[slot]
+	c.mu.RUnlock()
+	// 哈希槽未分配时，任选一个节点，由节点返回重定向
+	if addr == "" {
+		addr = c.startupAddrs[0]
+	}
+	return addr, nil
+}
+
+// 通过 CLUSTER SLOTS 刷新哈希槽分布，依次尝试已知的节点
+func (c *ClusterClient) refreshSlots(ctx context.Context) error {
+	c.mu.RLock()
+	addrs := append([]string(nil), c.startupAddrs...)
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	if len(addrs) == 0 {
+		return errors.New("no cluster address configured")
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		reply, err := redis.Values(c.node(addr).doAsking(ctx, false, "CLUSTER", "SLOTS"))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var slots [clusterSlots]string
+		for _, item := range reply {
+			start, end, master, err := parseSlotRange(item)
+			if err != nil {
+				return err
+			}
+			for slot := start; slot <= end && slot < clusterSlots; slot++ {
+				slots[slot] = master
+			}
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("can not load cluster slots, err: %w", lastErr)
+}
+
+// 解析 CLUSTER SLOTS 回复中的一项：起始哈希槽、结束哈希槽、主节点 [ip, port, id]、从节点...
+func parseSlotRange(item interface{}) (int, int, string, error) {
+	values, err := redis.Values(item, nil)
+	if err != nil || len(values) < 3 {
+		return 0, 0, "", fmt.Errorf("invalid CLUSTER SLOTS reply: %v", item)
+	}
+	start, err1 := redis.Int(values[0], nil)
+	end, err2 := redis.Int(values[1], nil)
+	node, err3 := redis.Values(values[2], nil)
+	if err1 != nil || err2 != nil || err3 != nil || len(node) < 2 {
+		return 0, 0, "", fmt.Errorf("invalid CLUSTER SLOTS reply: %v", item)
+	}
+	host, err1 := redis.String(node[0], nil)
+	port, err2 := redis.Int(node[1], nil)
+	if err1 != nil || err2 != nil {
+		return 0, 0, "", fmt.Errorf("invalid CLUSTER SLOTS reply: %v", item)
+	}
+	return start, end, net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// 关闭所有节点的客户端
+func (c *ClusterClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for addr, node := range c.nodes {
+		if err := node.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(c.nodes, addr)
+	}
+	return errors.Join(errs...)
+}
+
+// 节点的客户端，不存在时创建
+func (c *ClusterClient) node(addr string) *Client {
+	c.mu.RLock()
+	node, ok := c.nodes[addr]
+	c.mu.RUnlock()
+	if ok {
+		return node
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok = c.nodes[addr]; ok {
+		return node
+	}
+	node = &Client{ClientOptions: c.ClientOptions}
+	node.address = addr
+	node.pool = node.getRedisPool()
+	node.metrics.watchClient(node)
+	c.nodes[addr] = node
+	return node
+}
+
+// 执行命令，asking 为 true 时先发送 ASKING，用于 ASK 重定向
+func (c *Client) doAsking(ctx context.Context, asking bool, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if asking {
+		if _, err := redis.DoContext(conn, ctx, "ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+// 解析 MOVED、ASK 重定向错误，例如 MOVED 3999 127.0.0.1:6381
+func parseRedirect(err error) (moved bool, addr string, ok bool) {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return false, "", false
+	}
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return false, "", false
+	}
+	return fields[0] == "MOVED", fields[2], true
+}
+
+// key 所在的哈希槽，key 包含非空的哈希标签 {tag} 时只计算标签部分
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// CRC16-CCITT (XMODEM)，redis cluster 计算哈希槽使用的校验算法
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,133 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// 模拟 redis cluster，每个节点只处理自己负责的哈希槽，其余返回 MOVED
+type fakeCluster struct {
+	mu    sync.Mutex
+	nodes []*miniredis.Miniredis
+	// 哈希槽小于 split 的由 nodes[0] 负责，其余由 nodes[1] 负责
+	split int
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	f := fakeCluster{nodes: []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t)}, split: clusterSlots / 2}
+	for i, node := range f.nodes {
+		i := i
+		node.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+			return f.hook(i, c, cmd, args)
+		})
+	}
+	return &f
+}
+
+func (f *fakeCluster) owner(slot int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if slot < f.split {
+		return 0
+	}
+	return 1
+}
+
+func (f *fakeCluster) hook(i int, c *server.Peer, cmd string, args []string) bool {
+	var key string
+	switch strings.ToUpper(cmd) {
+	case "CLUSTER":
+		f.mu.Lock()
+		split := f.split
+		f.mu.Unlock()
+		c.WriteLen(2)
+		for n, r := range [][2]int{{0, split - 1}, {split, clusterSlots - 1}} {
+			c.WriteLen(3)
+			c.WriteInt(r[0])
+			c.WriteInt(r[1])
+			c.WriteLen(2)
+			c.WriteBulk(f.nodes[n].Host())
+			port, _ := strconv.Atoi(f.nodes[n].Port())
+			c.WriteInt(port)
+		}
+		return true
+	case "EVAL", "EVALSHA":
+		if len(args) > 2 && args[1] != "0" {
+			key = args[2]
+		}
+	case "GET", "SET", "DEL":
+		key = args[0]
+	}
+	if key == "" {
+		return false
+	}
+	slot := keySlot(key)
+	if owner := f.owner(slot); owner != i {
+		c.WriteError("MOVED " + strconv.Itoa(slot) + " " + f.nodes[owner].Addr())
+		return true
+	}
+	return false
+}
+
+// 哈希槽的计算与 redis cluster 一致
+func Test_keySlot(t *testing.T) {
+	for key, slot := range map[string]int{"foo": 12182, "bar": 5061, "{foo}.bar": 12182} {
+		if got := keySlot(key); got != slot {
+			t.Errorf("key: %s, got slot: %d, expect: %d", key, got, slot)
+		}
+	}
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Error("expect keys with same hash tag in the same slot")
+	}
+	t.Log("success")
+}
+
+// 集群客户端按照哈希槽路由锁 key，哈希槽迁移后跟随 MOVED 重定向
+func Test_clusterClient(t *testing.T) {
+	cluster := newFakeCluster(t)
+	client := NewClusterClient([]string{cluster.nodes[0].Addr()}, "")
+	ctx := context.Background()
+	// 两把锁的哈希槽分别由不同的节点负责
+	keys := []string{"{a}", "{b}"}
+	if cluster.owner(keySlot(keys[0])) == cluster.owner(keySlot(keys[1])) {
+		t.Fatal("expect keys in different nodes")
+	}
+	for _, key := range keys {
+		lock := NewRedisLock(key, client, SetExpireSeconds(5))
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		owner := cluster.nodes[cluster.owner(keySlot(key))]
+		if !owner.Exists(lock.getLockKey()) || !owner.Exists(lock.getFencingKey()) {
+			t.Errorf("expect lock key %s in node %s", key, owner.Addr())
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 所有哈希槽迁移到 nodes[0]
+	cluster.mu.Lock()
+	cluster.split = clusterSlots
+	cluster.mu.Unlock()
+	lock := NewRedisLock("{b}", client, SetExpireSeconds(5))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !cluster.nodes[0].Exists(lock.getLockKey()) {
+		t.Error("expect lock key moved to new node")
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// lua 脚本的 key 需要位于同一个哈希槽
+	if _, err := client.Eval(ctx, LuaLock, 2, []interface{}{"a", "b", "token", 5}); err == nil {
+		t.Error("expect err when keys in different slots")
+	}
+	t.Log("success")
+}
@@ -0,0 +1,264 @@
+// lockctl 用于查看、强制释放 redis 分布式锁，以及实时观察锁的变化
+//
+//	lockctl -addr 127.0.0.1:6379 list -pattern 'order_*'
+//	lockctl -output json show order_1
+//	lockctl force-release order_1
+//	lockctl watch -interval 500ms
+//	lockctl -namespace prod list
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	lock "redis_distributed_lock"
+)
+
+// 输出格式
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+const usage = `usage: lockctl [flags] <command> [args]
+
+commands:
+  list [-pattern p]          list held locks whose key matches the glob pattern
+  show <key>                 show owners and remaining ttl of one lock
+  force-release [-y] <key>   delete the lock regardless of its owner after confirmation
+  watch [-pattern p] [-interval d]
+                             print lock acquire, owner change and release events
+
+keys are given without the prefix (default %s) and namespace.
+
+flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "lockctl:", err)
+		os.Exit(1)
+	}
+}
+
+// 命令行的上下文
+type cli struct {
+	client *lock.Client
+	// 锁所在的前缀、命名空间
+	scope  []lock.LockOption
+	output string
+	in     *bufio.Reader
+	out    io.Writer
+}
+
+func run(ctx context.Context, args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("lockctl", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), usage, lock.LockKeyPrefix)
+		fs.PrintDefaults()
+	}
+	network := fs.String("network", "tcp", "redis network")
+	addr := fs.String("addr", "127.0.0.1:6379", "redis address")
+	password := fs.String("password", "", "redis password")
+	prefix := fs.String("prefix", lock.LockKeyPrefix, "lock key prefix")
+	namespace := fs.String("namespace", "", "lock key namespace")
+	output := fs.String("output", outputTable, "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("unknown output format: %s", *output)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+	c := cli{
+		client: lock.NewClient(*network, *addr, *password, lock.SetMaxIdleLinks(1)),
+		scope:  []lock.LockOption{lock.SetKeyPrefix(*prefix), lock.SetNamespace(*namespace)},
+		output: *output,
+		in:     bufio.NewReader(in),
+		out:    out,
+	}
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "list":
+		return c.list(ctx, cmdArgs)
+	case "show":
+		return c.show(ctx, cmdArgs)
+	case "force-release":
+		return c.forceRelease(ctx, cmdArgs)
+	case "watch":
+		return c.watch(ctx, cmdArgs)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+}
+
+func (c *cli) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	pattern := fs.String("pattern", "*", "glob pattern of lock keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	infos, err := c.client.ListLocks(ctx, *pattern, c.scope...)
+	if err != nil {
+		return err
+	}
+	if c.output == outputJSON {
+		return c.printJSON(infos)
+	}
+	return c.printLocks(infos)
+}
+
+func (c *cli) show(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: lockctl show <key>")
+	}
+	info, err := c.client.Inspect(ctx, args[0], c.scope...)
+	if err != nil {
+		return err
+	}
+	if c.output == outputJSON {
+		return c.printJSON(info)
+	}
+	return c.printLocks([]lock.LockInfo{*info})
+}
+
+func (c *cli) forceRelease(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("force-release", flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	yes := fs.Bool("y", false, "skip confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: lockctl force-release [-y] <key>")
+	}
+	key := fs.Arg(0)
+	info, err := c.client.Inspect(ctx, key, c.scope...)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		if err := c.printLocks([]lock.LockInfo{*info}); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "force release lock %s? the owners will not be notified [y/N]: ", key)
+		answer, err := c.in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("aborted")
+		}
+	}
+	if err := c.client.ForceRelease(ctx, key, c.scope...); err != nil {
+		return err
+	}
+	if c.output == outputJSON {
+		return c.printJSON(map[string]string{"key": key, "result": "released"})
+	}
+	fmt.Fprintf(c.out, "lock %s released\n", key)
+	return nil
+}
+
+func (c *cli) watch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	pattern := fs.String("pattern", "*", "glob pattern of lock keys")
+	interval := fs.Duration("interval", time.Second, "poll interval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	err := c.client.WatchLocks(ctx, *pattern, *interval, func(event lock.LockEvent) error {
+		if c.output == outputJSON {
+			return c.printJSON(event)
+		}
+		_, err := fmt.Fprintf(c.out, "%s\t%-8s\t%s\t%s\n", event.Time.Format(time.RFC3339),
+			event.Type, event.Lock.Key, formatOwners(event.Lock.Owners))
+		return err
+	}, c.scope...)
+	// 中断退出不视为错误
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// 以表格输出锁
+func (c *cli) printLocks(infos []lock.LockInfo) error {
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tKIND\tTTL\tOWNERS\tMETADATA")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Key, info.Kind, formatTTL(info.TTLMillis),
+			formatOwners(info.Owners), formatMetadata(info.Metadata))
+	}
+	return w.Flush()
+}
+
+// 以 json 输出，每个值一行，便于 watch 时逐行处理
+func (c *cli) printJSON(v interface{}) error {
+	return json.NewEncoder(c.out).Encode(v)
+}
+
+func formatTTL(millis int64) string {
+	if millis < 0 {
+		return "none"
+	}
+	return (time.Duration(millis) * time.Millisecond).String()
+}
+
+func formatOwners(owners []lock.LockOwner) string {
+	if len(owners) == 0 {
+		return "-"
+	}
+	items := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		switch {
+		case owner.Count > 0:
+			items = append(items, fmt.Sprintf("%s(x%d)", owner.Token, owner.Count))
+		case owner.LeaseMillis > 0:
+			items = append(items, fmt.Sprintf("%s(lease %s)", owner.Token, formatTTL(owner.LeaseMillis)))
+		default:
+			items = append(items, owner.Token)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func formatMetadata(metadata *lock.LockMetadata) string {
+	if metadata == nil {
+		return "-"
+	}
+	var items []string
+	for _, kv := range [][2]string{
+		{"service", metadata.Service},
+		{"host", metadata.Hostname},
+		{"purpose", metadata.Purpose},
+		{"trace", metadata.TraceID},
+	} {
+		if kv[1] != "" {
+			items = append(items, kv[0]+"="+kv[1])
+		}
+	}
+	if !metadata.AcquiredAt.IsZero() {
+		items = append(items, "acquired="+metadata.AcquiredAt.Format(time.RFC3339))
+	}
+	return strings.Join(items, " ")
+}
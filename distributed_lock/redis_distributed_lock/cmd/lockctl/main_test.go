@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	lock "redis_distributed_lock"
+)
+
+func runCmd(t *testing.T, addr, stdin string, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(context.Background(), append([]string{"-addr", addr}, args...), strings.NewReader(stdin), &out)
+	return out.String(), err
+}
+
+func Test_lockctl(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := lock.NewClient("tcp", mr.Addr(), "")
+	if err := lock.NewRedisLock("order_1", client, lock.SetOwnerToken("token_1")).Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCmd(t, mr.Addr(), "", "list", "-pattern", "order_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "order_1") || !strings.Contains(out, "token_1") {
+		t.Errorf("got list output: %s", out)
+	}
+
+	out, err = runCmd(t, mr.Addr(), "", "-output", "json", "show", "order_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info lock.LockInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "order_1" || info.Kind != lock.LockKindExclusive || info.Owners[0].Token != "token_1" {
+		t.Errorf("got lock: %+v", info)
+	}
+
+	// 未确认时不释放锁
+	if _, err := runCmd(t, mr.Addr(), "n\n", "force-release", "order_1"); err == nil {
+		t.Error("expect err when release is not confirmed")
+	}
+	if !mr.Exists(lock.LockKeyPrefix + "order_1") {
+		t.Fatal("lock released without confirmation")
+	}
+	if _, err := runCmd(t, mr.Addr(), "y\n", "force-release", "order_1"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(lock.LockKeyPrefix + "order_1") {
+		t.Error("lock is not released")
+	}
+
+	if _, err := runCmd(t, mr.Addr(), "", "unknown"); err == nil {
+		t.Error("expect err of unknown command")
+	}
+	t.Log("success")
+}
@@ -1,6 +1,10 @@
 package redis_distributed_lock
 
-import "time"
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 // 默认配置参数
 const (
@@ -16,8 +20,14 @@ const (
 	DefaultDistributedLockExpireSeconds = 30
 	// 看门狗工作间隔时间
 	DefaultWatchDogStepSeconds = 10
+	// 公平锁等锁者的心跳超时时间，超时未再次尝试取锁的等锁者会被清出等锁队列
+	DefaultFairWaiterTimeoutMillis = 5000
+	// 阻塞等锁订阅了锁释放通知时，兜底轮询的时间间隔
+	DefaultReleaseFallbackPollInterval = 500 * time.Millisecond
 	// 红锁默认过期时间
 	DefaultSingleLockTimeout = 50 * time.Millisecond
+	// 重试策略的最小重试间隔，避免无间隔地轮询 redis
+	MinRetryInterval = 10 * time.Millisecond
 )
 
 // 客户端配置
@@ -32,6 +42,10 @@ type ClientOptions struct {
 	address string
 	// 密码
 	password string
+	// 哨兵的密码，哨兵未开启认证时为空
+	sentinelPassword string
+	// 连接池指标
+	metrics *Metrics
 }
 
 type ClientOption func(c *ClientOptions)
@@ -54,6 +68,19 @@ func SetMaxIdleLinks(mil int) ClientOption {
 	}
 }
 
+func SetSentinelPassword(sp string) ClientOption {
+	return func(c *ClientOptions) {
+		c.sentinelPassword = sp
+	}
+}
+
+// 统计连接池的活跃、空闲连接数，客户端调用 Close 后不再统计
+func SetClientMetrics(m *Metrics) ClientOption {
+	return func(c *ClientOptions) {
+		c.metrics = m
+	}
+}
+
 func ActiveWaitMode() ClientOption {
 	return func(c *ClientOptions) {
 		c.wait = true
@@ -76,13 +103,35 @@ func checkClientOptions(c *ClientOptions) {
 type LockOptions struct {
 	blockMode           bool
 	blockWaitingSeconds int64
-	expireSeconds       int64
-	watchDogMode        bool
-	watchDogStep        int64
+	// 毫秒精度的等锁时间上限，设置时优先于 blockWaitingSeconds
+	blockWaitingMillis int64
+	retryStrategy      RetryStrategy
+	expireSeconds      int64
+	watchDogMode       bool
+	watchDogStep       int64
+	reentrantMode      bool
+	fairMode           bool
+	token              string
+	metrics            *Metrics
+	tracer             trace.Tracer
+	// 锁持有者的元数据，为 nil 时不记录
+	metadata *LockMetadata
+	// 锁 key 的前缀、命名空间，以及是否以哈希标签包裹锁 key
+	keyPrefix string
+	namespace string
+	hashTag   bool
 }
 
 type LockOption func(*LockOptions)
 
+// 等锁时间上限
+func (o *LockOptions) blockWaiting() time.Duration {
+	if o.blockWaitingMillis > 0 {
+		return time.Duration(o.blockWaitingMillis) * time.Millisecond
+	}
+	return time.Duration(o.blockWaitingSeconds) * time.Second
+}
+
 func ActiveBlockMode() LockOption {
 	return func(o *LockOptions) {
 		o.blockMode = true
@@ -95,14 +144,65 @@ func SetBlockWaitingSeconds(bws int64) LockOption {
 	}
 }
 
+// 毫秒精度的等锁时间上限
+func SetBlockWaitingMillis(bwm int64) LockOption {
+	return func(o *LockOptions) {
+		o.blockWaitingMillis = bwm
+	}
+}
+
+// 阻塞模式下的重试策略，设置后按照策略轮询取锁，不再订阅锁释放通知
+// 公平锁的等锁者超过 DefaultFairWaiterTimeoutMillis 未再次取锁会被清出等锁队列，
+// 读写锁等待中的写锁登记在 1s 后失效，因此重试间隔需要小于对应的时长
+func SetRetryStrategy(rs RetryStrategy) LockOption {
+	return func(o *LockOptions) {
+		o.retryStrategy = rs
+	}
+}
+
 func SetExpireSeconds(es int64) LockOption {
 	return func(o *LockOptions) {
 		o.expireSeconds = es
 	}
 }
 
+// 可重入模式，同一 token 可以多次加锁，重入次数记录在 redis hash 中
+func ActiveReentrantMode() LockOption {
+	return func(o *LockOptions) {
+		o.reentrantMode = true
+	}
+}
+
+// 指定锁持有者的 token，未指定时使用 GetOwnerToken 生成的全局唯一 token
+// 指定的 token 需要保证全局唯一，相同 token 的持有者会被视为同一个持有者
+func SetOwnerToken(token string) LockOption {
+	return func(o *LockOptions) {
+		o.token = token
+	}
+}
+
+// 统计加锁、解锁以及看门狗续期的指标，对 RedisLock、RedisRWLock、RedisSemaphore、RedisMultiLock 均生效
+func SetLockMetrics(m *Metrics) LockOption {
+	return func(o *LockOptions) {
+		o.metrics = m
+	}
+}
+
+// 公平模式，阻塞等锁者按到达顺序获取锁，仅对非可重入锁生效
+func ActiveFairMode() LockOption {
+	return func(o *LockOptions) {
+		o.fairMode = true
+	}
+}
+
 func checkLockOptions(o *LockOptions) {
-	if o.blockMode && o.blockWaitingSeconds <= 0 {
+	if o.token == "" {
+		o.token = GetOwnerToken()
+	}
+	if o.tracer == nil {
+		o.tracer = noopTracer()
+	}
+	if o.blockMode && o.blockWaitingSeconds <= 0 && o.blockWaitingMillis <= 0 {
 		o.blockWaitingSeconds = DefaultBlockWaitingSeconds
 	}
 	// 倘若未设置分布式锁的过期时间，则会启动 watchdog
@@ -139,11 +239,15 @@ func checkRedLockOption(o *RedLockOptions) {
 	if o.singleNodesTimeout <= 0 {
 		o.singleNodesTimeout = DefaultSingleLockTimeout
 	}
+	if o.expireDuration <= 0 {
+		o.expireDuration = DefaultDistributedLockExpireSeconds * time.Second
+	}
 }
 
+// 红锁单节点配置
 type SingleNodeConf struct {
 	Network  string
 	Address  string
 	Password string
-	Opts     []ClientOptions
+	Opts     []ClientOption
 }
@@ -0,0 +1,181 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var ErrNoLeader = errors.New("no leader is elected")
+
+// 等待 leader 租约到期时额外等待的时间，避免在租约到期的临界点取锁失败
+const leaseExpiryMargin = 10 * time.Millisecond
+
+// 基于 RedisLock 的选主，持有锁的候选者即为 leader，看门狗持续为 leader 续期
+// 候选者的 token 即为 leader 的标识，建议通过 SetOwnerToken 指定，例如主机名
+// leader 主动让位时会发布锁释放通知，follower 立即参与选举；leader 宕机时，follower 在其租约到期时参与选举
+type Election struct {
+	lock *RedisLock
+	// 终止当选后看门狗使用的 ctx，当选后 leader 身份不受 Campaign 的 ctx 影响，直到让位或者锁丢失
+	cancel context.CancelFunc
+}
+
+// 初始化，未设置锁的过期时间时由看门狗为 leader 续期
+func NewElection(key string, client LockClient, opts ...LockOption) *Election {
+	return &Election{lock: NewRedisLock(key, client, opts...)}
+}
+
+// 参与选举，当选 leader 或者 ctx 终止时返回，已经是 leader 时直接返回
+// ctx 只控制等待当选的时长，当选后直到让位或者锁丢失之前都是 leader
+func (e *Election) Campaign(ctx context.Context) error {
+	if e.IsLeader() {
+		return nil
+	}
+	// 先订阅锁释放通知，避免错过取锁失败之后 leader 的让位
+	released, unsubscribe := subscribeRelease(ctx, e.lock.client, []string{e.lock.getChannel()})
+	defer unsubscribe()
+	for {
+		err := e.tryLock(ctx)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryableErr(err) {
+			return err
+		}
+		// 等到 leader 的租约到期时再次参与选举，未订阅到锁释放通知时以兜底间隔轮询
+		wait := DefaultReleaseFallbackPollInterval
+		if _, ttl, err := e.leader(ctx); err == nil && ttl >= 0 && (released != nil || ttl < wait) {
+			wait = ttl + leaseExpiryMargin
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-released:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// 尝试当选一次，当选后看门狗使用选举自身的 ctx，ctx 只在取锁期间终止取锁
+func (e *Election) tryLock(ctx context.Context) error {
+	leaderCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	err := e.lock.TryLock(leaderCtx)
+	if !stop() {
+		// 取锁期间 ctx 终止，放弃可能已经取得的锁
+		if err == nil {
+			_ = e.lock.Unlock(context.WithoutCancel(ctx))
+		}
+		return ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+	// 之前的 leader 身份因为锁丢失而结束时，回收之前的 ctx
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.cancel = cancel
+	return nil
+}
+
+// 主动让位，释放锁并通知 follower 参与选举
+func (e *Election) Resign(ctx context.Context) error {
+	if !e.IsLeader() {
+		return fmt.Errorf("can not resign, err: %w", ErrLockNotOwned)
+	}
+	defer e.cancel()
+	return e.lock.Unlock(ctx)
+}
+
+// 当前是否为 leader，续期失败导致锁丢失后不再是 leader
+func (e *Election) IsLeader() bool {
+	lease := e.lock.lease
+	if lease == nil {
+		return false
+	}
+	select {
+	case <-lease.lost:
+		return false
+	case <-lease.released:
+		return false
+	default:
+		return true
+	}
+}
+
+// 失去 leader 身份的通知，续期失败导致锁丢失时 channel 会被关闭。未当选时返回 nil
+func (e *Election) Lost() <-chan struct{} {
+	return e.lock.Lost()
+}
+
+// 当前 leader 的 token，没有 leader 时返回 ErrNoLeader
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	token, _, err := e.leader(ctx)
+	return token, err
+}
+
+// 当前 leader 的 token 及其租约的剩余时间
+func (e *Election) leader(ctx context.Context) (string, time.Duration, error) {
+	reply, err := redis.Values(e.lock.client.Eval(ctx, LuaLockHolder, 1, []interface{}{e.lock.getLockKey()}))
+	if err != nil {
+		return "", 0, err
+	}
+	if len(reply) == 0 {
+		return "", 0, ErrNoLeader
+	}
+	var token string
+	var pttl int64
+	if _, err := redis.Scan(reply, &token, &pttl); err != nil {
+		return "", 0, err
+	}
+	return token, time.Duration(pttl) * time.Millisecond, nil
+}
+
+// 观察 leader 的变化，返回的 channel 先推送当前的 leader，之后每次 leader 变化时推送新 leader 的 token，
+// 没有 leader 时推送空串。ctx 终止时 channel 被关闭，读取过慢时只保留最新的 leader
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		defer close(ch)
+		released, unsubscribe := subscribeRelease(ctx, e.lock.client, []string{e.lock.getChannel()})
+		defer unsubscribe()
+		last, first := "", true
+		for {
+			token, ttl, err := e.leader(ctx)
+			if err == nil || errors.Is(err, ErrNoLeader) {
+				if first || token != last {
+					// 丢弃未被读取的旧 leader
+					select {
+					case <-ch:
+					default:
+					}
+					ch <- token
+					last, first = token, false
+				}
+			}
+			// leader 让位后新 leader 当选不会发布通知，因此以兜底间隔轮询，leader 租约更早到期时提前查看
+			wait := DefaultReleaseFallbackPollInterval
+			if ttl >= 0 && err == nil && ttl < wait {
+				wait = ttl + leaseExpiryMargin
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-released:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}()
+	return ch
+}
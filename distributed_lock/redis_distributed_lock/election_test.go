@@ -0,0 +1,172 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 读取下一个 leader
+func nextLeader(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case leader := <-ch:
+		return leader
+	case <-time.After(3 * time.Second):
+		t.Fatal("no leader change observed")
+		return ""
+	}
+}
+
+// leader 让位后 follower 立即当选，观察者依次收到 leader 的变化
+func Test_election(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e1 := NewElection("test_election_key", client, SetOwnerToken("node_1"))
+	e2 := NewElection("test_election_key", client, SetOwnerToken("node_2"))
+	observer := NewElection("test_election_key", client)
+
+	if _, err := observer.Leader(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("got err: %v, expect: %v", err, ErrNoLeader)
+	}
+	changes := observer.Observe(ctx)
+	if leader := nextLeader(t, changes); leader != "" {
+		t.Errorf("got leader: %s, expect no leader", leader)
+	}
+	if err := e1.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !e1.IsLeader() || e2.IsLeader() {
+		t.Error("expect node_1 to be the only leader")
+	}
+	if leader, err := e2.Leader(ctx); err != nil || leader != "node_1" {
+		t.Errorf("got leader: %s, err: %v, expect: node_1", leader, err)
+	}
+	if leader := nextLeader(t, changes); leader != "node_1" {
+		t.Errorf("got leader: %s, expect: node_1", leader)
+	}
+
+	elected := make(chan error, 1)
+	go func() {
+		elected <- e2.Campaign(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-elected; err != nil {
+		t.Fatal(err)
+	}
+	// 通过锁释放通知立即当选
+	if cost := time.Since(start); cost >= DefaultReleaseFallbackPollInterval {
+		t.Errorf("node_2 elected after %v", cost)
+	}
+	if e1.IsLeader() || !e2.IsLeader() {
+		t.Error("expect node_2 to be the only leader")
+	}
+	if err := e1.Resign(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	// 观察者可能看到短暂的无 leader 状态
+	leader := nextLeader(t, changes)
+	if leader == "" {
+		leader = nextLeader(t, changes)
+	}
+	if leader != "node_2" {
+		t.Errorf("got leader: %s, expect: node_2", leader)
+	}
+	if err := e2.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range changes {
+	}
+	t.Log("success")
+}
+
+// leader 宕机后，follower 在其租约到期时当选
+func Test_electionFailover(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	// 不续期的 leader，模拟宕机
+	crashed := NewElection("test_election_failover_key", client, SetOwnerToken("crashed"), SetExpireSeconds(1))
+	follower := NewElection("test_election_failover_key", client, SetOwnerToken("follower"))
+	if err := crashed.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	campaignCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := follower.Campaign(campaignCtx); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost > 1500*time.Millisecond {
+		t.Errorf("follower elected after %v", cost)
+	}
+	select {
+	case <-crashed.Lost():
+	case <-time.After(time.Second):
+		t.Error("expect crashed leader to lose leadership")
+	}
+	if crashed.IsLeader() {
+		t.Error("expect crashed node not to be leader")
+	}
+	if err := follower.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// Campaign 的 ctx 终止后，已经当选的 leader 仍然保持 leader 身份，直到让位
+func Test_electionCampaignCtx(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	e := NewElection("test_election_ctx_key", client, SetOwnerToken("node_1"))
+	e.lock.watchDogStep = 1
+	campaignCtx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := e.Campaign(campaignCtx); err != nil {
+		t.Fatal(err)
+	}
+	<-campaignCtx.Done()
+	// 等待看门狗续期
+	select {
+	case <-e.Lost():
+		t.Fatal("leadership lost after campaign ctx is done")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	ctx := context.Background()
+	if leader, err := e.Leader(ctx); !e.IsLeader() || err != nil || leader != "node_1" {
+		t.Errorf("got leader: %s, err: %v, expect: node_1", leader, err)
+	}
+	if err := e.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.IsLeader() {
+		t.Error("expect node_1 not to be leader after resign")
+	}
+	t.Log("success")
+}
+
+// 可重入模式下同样可以查看以及观察 leader
+func Test_electionReentrant(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := NewElection("test_election_reentrant_key", client, SetOwnerToken("node_1"), ActiveReentrantMode())
+	if err := e.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err := e.Leader(ctx); err != nil || leader != "node_1" {
+		t.Errorf("got leader: %s, err: %v, expect: node_1", leader, err)
+	}
+	if leader := nextLeader(t, e.Observe(ctx)); leader != "node_1" {
+		t.Errorf("got leader: %s, expect: node_1", leader)
+	}
+	if err := e.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
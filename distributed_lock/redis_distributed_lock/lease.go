@@ -0,0 +1,93 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 单次持有锁期间的状态，用于通知锁丢失
+type lockLease struct {
+	mu       sync.Mutex
+	lost     chan struct{}
+	released chan struct{}
+	err      error
+	// 非看门狗模式下，锁到期时触发锁丢失
+	expiryTimer *time.Timer
+}
+
+func newLockLease() *lockLease {
+	return &lockLease{
+		lost:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+}
+
+// 锁丢失，只会生效一次，锁已经释放时不处理
+func (l *lockLease) markLost(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.lost:
+		return
+	case <-l.released:
+		return
+	default:
+	}
+	l.err = fmt.Errorf("%w, err: %v", ErrLockLost, err)
+	close(l.lost)
+}
+
+// 锁被主动释放，只会生效一次
+func (l *lockLease) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expiryTimer != nil {
+		l.expiryTimer.Stop()
+	}
+	select {
+	case <-l.lost:
+		return
+	case <-l.released:
+		return
+	default:
+	}
+	close(l.released)
+}
+
+// 锁在 expire 之后到期，届时仍未释放则视为锁丢失
+func (l *lockLease) expireAfter(expire time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expiryTimer != nil {
+		l.expiryTimer.Reset(expire)
+		return
+	}
+	l.expiryTimer = time.AfterFunc(expire, func() {
+		l.markLost(fmt.Errorf("lock expired after %v", expire))
+	})
+}
+
+// 锁丢失的原因
+func (l *lockLease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// 派生 ctx，锁丢失或者被释放时取消，锁丢失时可以通过 context.Cause 获取原因
+func (l *lockLease) context(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case <-l.lost:
+			cancel(l.Err())
+		case <-l.released:
+			cancel(nil)
+		case <-ctx.Done():
+			cancel(nil)
+		}
+	}()
+	return ctx
+}
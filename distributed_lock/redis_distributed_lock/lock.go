@@ -5,14 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
-	"sync/atomic"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
+// 默认的锁 key 前缀，可以通过 SetKeyPrefix 修改
 const LockKeyPrefix = "REDIS_LOCK_PRE_"
 
 var ErrLockAcquiredByOthers = errors.New("lock is acquired by others")
 
+var ErrLockNotOwned = errors.New("lock is not owned by current token")
+
+var ErrLockLost = errors.New("lock is lost")
+
 var ErrNil = redis.ErrNil
 
 func IsRetryableErr(err error) bool {
@@ -22,18 +27,25 @@ func IsRetryableErr(err error) bool {
 // redis分布式锁
 type RedisLock struct {
 	LockOptions
-	key        string
-	token      string
-	client     LockClient
-	runningDog int32
-	stopDog    context.CancelFunc
+	key    string
+	client LockClient
+	dog    watchDog
+	// 可重入模式下，当前 token 的重入次数
+	reentrantCount int64
+	// 最近一次加锁成功获得的 fencing token
+	fencingToken int64
+	// 本次持有锁期间的状态
+	lease *lockLease
+	// 首次加锁成功的时间
+	lockedAt time.Time
+	// 本次加锁尝试取锁的次数
+	attempts int
 }
 
 // 初始化
 func NewRedisLock(key string, client LockClient, opts ...LockOption) *RedisLock {
 	r := RedisLock{
 		key:    key,
-		token:  GetProcessAndGoroutineIDStr(),
 		client: client,
 	}
 	for _, opt := range opts {
@@ -45,26 +57,131 @@ func NewRedisLock(key string, client LockClient, opts ...LockOption) *RedisLock
 
 // lock key
 func (r *RedisLock) getLockKey() string {
-	return LockKeyPrefix + r.key
+	return r.lockKey(r.key)
+}
+
+// 锁释放通知频道
+func (r *RedisLock) getChannel() string {
+	return r.getLockKey() + "_CHANNEL"
+}
+
+// fencing token 计数器 key，不设置过期时间，保证 fencing token 严格递增
+func (r *RedisLock) getFencingKey() string {
+	return r.getLockKey() + "_FENCE"
+}
+
+// 公平锁等锁队列 key
+func (r *RedisLock) getQueueKey() string {
+	return r.getLockKey() + "_QUEUE"
+}
+
+// 公平锁等锁者心跳 key
+func (r *RedisLock) getQueueTimeoutKey() string {
+	return r.getLockKey() + "_QUEUE_TIMEOUT"
+}
+
+// 是否以公平模式加锁
+func (r *RedisLock) isFair() bool {
+	return r.fairMode && !r.reentrantMode
 }
 
 // 加锁
-func (r *RedisLock) Lock(ctx context.Context) (err error) {
+func (r *RedisLock) Lock(ctx context.Context) error {
+	return r.lock(ctx, "RedisLock.Lock", func(ctx context.Context) error {
+		return acquire(ctx, "RedisLock.blockingLock", &r.LockOptions, r.client, []string{r.getChannel()}, r.tryLock)
+	})
+}
+
+// 尝试加锁一次，不论是否为阻塞模式
+func (r *RedisLock) TryLock(ctx context.Context) error {
+	return r.lock(ctx, "RedisLock.TryLock", r.tryLock)
+}
+
+// 加锁成功后开始本次持有锁的状态
+func (r *RedisLock) lock(ctx context.Context, spanName string, acquire func(ctx context.Context) error) (err error) {
 	defer func() {
 		if err != nil {
 			return
 		}
+		// 可重入模式下，只有首次加锁成功时才启动看门狗，避免同一把锁下看门狗重复启动
+		firstLocked := !r.reentrantMode || r.reentrantCount == 1
+		if firstLocked || r.lease == nil {
+			// 之前的持有状态未通过解锁结束时（例如锁丢失后重新加锁），先结束之前的持有状态，
+			// 避免之前的看门狗以及 LockContext 的协程泄漏
+			if firstLocked {
+				r.release()
+			}
+			r.lease = newLockLease()
+			r.lockedAt = time.Now()
+		}
+		// 非看门狗模式下，锁到期后视为锁丢失，重入时锁的过期时间会被刷新
+		if !r.watchDogMode {
+			r.lease.expireAfter(time.Duration(r.expireSeconds) * time.Second)
+		}
 		// 加锁成功的情况下，会启动看门狗
-		// 关于该锁本身是不可重入的，所以不会出现同一把锁下看门狗重复启动的情况
-		r.watchDog(ctx)
+		if firstLocked {
+			r.watchDog(ctx)
+		}
 	}()
+	// 看门狗使用调用方的 ctx，续期的 span 不会挂在已经结束的加锁 span 下
+	spanCtx, span := r.tracer.Start(ctx, spanName, trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrBlockMode.Bool(r.blockMode)))
+	r.attempts = 0
+	start := time.Now()
+	err = acquire(spanCtx)
+	r.metrics.acquired(err, time.Since(start))
+	// 公平模式下放弃等锁时，需要退出等锁队列，避免阻塞后续的等锁者
+	if err != nil && r.isFair() && r.blockMode {
+		r.cancelWaiting(spanCtx)
+	}
+	span.SetAttributes(attrRetries.Int(max(r.attempts-1, 0)))
+	endSpan(span, acquireOutcome(err), err)
+	return err
+}
+
+// 加锁，成功时返回本次加锁获得的 fencing token
+// fencing token 对同一个 key 严格递增，下游存储可以据此拒绝持有过期锁的客户端的写入，
+// 例如 GORM 更新时附带条件 fencing_token < ?，并写入新的 fencing token
+func (r *RedisLock) LockWithToken(ctx context.Context) (int64, error) {
+	if err := r.Lock(ctx); err != nil {
+		return 0, err
+	}
+	return r.fencingToken, nil
+}
+
+// 最近一次加锁成功获得的 fencing token
+func (r *RedisLock) FencingToken() int64 {
+	return r.fencingToken
+}
+
+// 加锁，成功时返回派生自 ctx 的 lockCtx
+// 锁丢失时 lockCtx 会被取消，可以通过 context.Cause(lockCtx) 获取原因，解锁时 lockCtx 同样会被取消
+func (r *RedisLock) LockContext(ctx context.Context) (context.Context, error) {
+	if err := r.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return r.lease.context(ctx), nil
+}
+
+// 锁丢失通知，看门狗续期因为锁已不归属自己而失败、持续续期失败直到锁过期、加锁时的 ctx 在解锁之前终止，
+// 或者非看门狗模式下锁到期仍未解锁时，channel 会被关闭。未持有锁时返回 nil
+func (r *RedisLock) Lost() <-chan struct{} {
+	if r.lease == nil {
+		return nil
+	}
+	return r.lease.lost
+}
+
+// 加锁的通用流程，先尝试取锁一次，阻塞模式下再持续轮询取锁，spanName 为阻塞等锁的 span 名称
+func acquire(ctx context.Context, spanName string, o *LockOptions, client LockClient, channels []string,
+	tryLock func(ctx context.Context) error) error {
 	// 不管是不是阻塞模式，都要先获取一次锁
-	err = r.tryLock(ctx)
+	err := tryLock(ctx)
 	if err == nil {
 		return nil
 	}
 	// 非阻塞模式加锁失败直接返回错误
-	if !r.blockMode {
+	if !o.blockMode {
 		return err
 	}
 	// 判断错误是否可以允许重试，不可允许的类型则直接返回错误
@@ -72,94 +189,202 @@ func (r *RedisLock) Lock(ctx context.Context) (err error) {
 		return err
 	}
 	// 基于阻塞模式持续轮询取锁
-	err = r.blockingLock(ctx)
-	return err
+	return blockingLock(ctx, spanName, o, client, channels, tryLock)
 }
 
 // 尝试获取锁
 func (r *RedisLock) tryLock(ctx context.Context) error {
-	// 首先查询锁是否属于自己
-	reply, err := r.client.SetNEX(ctx, r.getLockKey(), r.token, r.expireSeconds)
+	r.metrics.attempt()
+	r.attempts++
+	if r.reentrantMode {
+		return r.tryReentrantLock(ctx)
+	}
+	if r.fairMode {
+		return r.tryFairLock(ctx)
+	}
+	// 锁不存在时加锁，同时递增 fencing token
+	keysAndArgs := []interface{}{r.getLockKey(), r.getFencingKey(), r.token, r.expireSeconds}
+	reply, err := r.eval(ctx, LuaLock, 2, keysAndArgs, r.lockMetadataArgs(ctx))
 	if err != nil {
 		return err
 	}
-	if reply != 1 {
-		return fmt.Errorf("reply: %d, err: %w", reply, ErrLockAcquiredByOthers)
+	fencingToken, _ := reply.(int64)
+	if fencingToken <= 0 {
+		return fmt.Errorf("reply: %d, err: %w", fencingToken, ErrLockAcquiredByOthers)
 	}
+	r.fencingToken = fencingToken
 	return nil
 }
 
-// 开启watchDog
-func (r *RedisLock) watchDog(ctx context.Context) {
-	// 1. 非看门狗模式，不处理
-	if !r.watchDogMode {
-		return
+// 尝试获取可重入锁
+func (r *RedisLock) tryReentrantLock(ctx context.Context) error {
+	keysAndArgs := []interface{}{r.getLockKey(), r.getFencingKey(), r.token, r.expireSeconds}
+	ret, err := redis.Int64s(r.eval(ctx, LuaReentrantLock, 2, keysAndArgs, r.lockMetadataArgs(ctx)))
+	if err != nil {
+		return err
 	}
-	// 2. 确保之前启动的看门狗已经正常回收
-	for !atomic.CompareAndSwapInt32(&r.runningDog, 0, 1) {
+	if len(ret) != 2 || ret[0] <= 0 {
+		return fmt.Errorf("reply: %v, err: %w", ret, ErrLockAcquiredByOthers)
 	}
-	// 3. 启动看门狗
-	ctx, r.stopDog = context.WithCancel(ctx)
-	go func() {
-		defer func() {
-			atomic.StoreInt32(&r.runningDog, 0)
-		}()
-		r.runWatchDog(ctx)
-	}()
+	r.reentrantCount, r.fencingToken = ret[0], ret[1]
+	return nil
 }
 
-// 通过定时器轮询
-func (r *RedisLock) runWatchDog(ctx context.Context) {
-	ticker := time.NewTicker(DefaultWatchDogStepSeconds * time.Second)
-	defer ticker.Stop()
-	for range ticker.C {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-		// 看门狗负责在用户未显式解锁时，持续为分布式锁进行续期
-		// 通过 lua 脚本，延期之前会确保保证锁仍然属于自己
-		// 为避免因为网络延迟而导致锁被提前释放的问题，watch dog 续约时需要把锁的过期时长额外增加 5 s
-		_ = r.DelayExpire(ctx, DefaultWatchDogStepSeconds+5)
+// 尝试获取公平锁，阻塞模式下加锁失败会进入等锁队列
+func (r *RedisLock) tryFairLock(ctx context.Context) error {
+	var waiterTimeout int64
+	if r.blockMode {
+		waiterTimeout = DefaultFairWaiterTimeoutMillis
+	}
+	keysAndArgs := []interface{}{r.getLockKey(), r.getQueueKey(), r.getQueueTimeoutKey(), r.getFencingKey(),
+		r.token, r.expireSeconds, waiterTimeout}
+	reply, err := r.eval(ctx, LuaFairLock, 4, keysAndArgs, r.lockMetadataArgs(ctx))
+	if err != nil {
+		return err
 	}
+	fencingToken, _ := reply.(int64)
+	if fencingToken <= 0 {
+		return fmt.Errorf("reply: %d, err: %w", fencingToken, ErrLockAcquiredByOthers)
+	}
+	r.fencingToken = fencingToken
+	return nil
+}
+
+// 退出公平锁的等锁队列
+func (r *RedisLock) cancelWaiting(ctx context.Context) {
+	// ctx 可能已经终止，使用独立的 ctx 保证能够退出队列
+	ctx = context.WithoutCancel(ctx)
+	keysAndArgs := []interface{}{r.getQueueKey(), r.getQueueTimeoutKey(), r.token, r.getChannel()}
+	_, _ = r.client.Eval(ctx, LuaFairLockCancelWaiting, 2, keysAndArgs)
+}
+
+// 开启watchDog
+func (r *RedisLock) watchDog(ctx context.Context) {
+	// 非看门狗模式，不处理
+	if !r.watchDogMode {
+		return
+	}
+	// 看门狗负责在用户未显式解锁时，持续为分布式锁进行续期
+	// 通过 lua 脚本，延期之前会确保保证锁仍然属于自己
+	// 续期因为锁已不归属自己而失败，或者持续失败直到锁过期时，通知锁丢失
+	r.dog.start(ctx, r.watchDogStep, func(ctx context.Context, expireSeconds int64) error {
+		err := r.DelayExpire(ctx, expireSeconds)
+		r.metrics.renewed(err)
+		return err
+	}, r.lease.markLost)
 }
 
 // 更新锁的过期时间，基于 lua 脚本实现操作原子性
-func (r *RedisLock) DelayExpire(ctx context.Context, expireSeconds int64) error {
+func (r *RedisLock) DelayExpire(ctx context.Context, expireSeconds int64) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisLock.DelayExpire", trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrExpireSeconds.Int64(expireSeconds)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeRenewed, err), err) }()
+	src := LuaCheckAndExpiredDistributedLock
+	if r.reentrantMode {
+		src = LuaCheckAndExpiredReentrantLock
+	}
 	keysAndArgs := []interface{}{r.getLockKey(), r.token, expireSeconds}
-	reply, err := r.client.Eval(ctx, LuaCheckAndExpiredDistributedLock, 1, keysAndArgs)
+	reply, err := r.eval(ctx, src, 1, keysAndArgs, nil)
 	if err != nil {
 		return err
 	}
 	if ret, _ := reply.(int64); ret != 1 {
-		return errors.New("can not expire lock without ownership of lock")
+		return fmt.Errorf("can not expire lock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 将锁的过期时间刷新为 expireSeconds，锁已不归属自己时返回 ErrLockNotOwned
+func (r *RedisLock) Refresh(ctx context.Context) error {
+	if err := r.DelayExpire(ctx, r.expireSeconds); err != nil {
+		return err
+	}
+	if !r.watchDogMode && r.lease != nil {
+		r.lease.expireAfter(time.Duration(r.expireSeconds) * time.Second)
 	}
 	return nil
 }
 
-// 阻塞锁
-func (r *RedisLock) blockingLock(ctx context.Context) error {
+// 阻塞模式下持续重试取锁，直到成功、ctx 终止或者达到等锁时间上限
+func blockingLock(ctx context.Context, spanName string, o *LockOptions, client LockClient, channels []string,
+	tryLock func(ctx context.Context) error) (err error) {
+	ctx, span := o.tracer.Start(ctx, spanName, trace.WithAttributes(
+		attrBlockWaiting.Int64(o.blockWaiting().Milliseconds())))
+	// 统计重试次数
+	var attempts int
+	try := tryLock
+	tryLock = func(ctx context.Context) error {
+		attempts++
+		return try(ctx)
+	}
+	defer func() {
+		span.SetAttributes(attrRetries.Int(max(attempts-1, 0)))
+		endSpan(span, acquireOutcome(err), err)
+	}()
 	// 阻塞模式等锁时间上限
-	timeoutCh := time.After(time.Duration(r.blockWaitingSeconds) * time.Second)
-	// 轮询 ticker，每隔 50 ms 尝试取锁一次
-	ticker := time.NewTicker(time.Duration(50) * time.Millisecond)
+	timeoutCh := time.After(o.blockWaiting())
+	// 指定了重试策略时，按照策略轮询取锁
+	if o.retryStrategy != nil {
+		return retryLock(ctx, o.retryStrategy, timeoutCh, tryLock)
+	}
+	// 订阅锁释放通知，订阅成功后只在收到通知时重试，并以较低的频率兜底轮询，避免错过通知
+	// 客户端不支持订阅或者订阅失败时，每隔 50 ms 尝试取锁一次
+	interval := time.Duration(50) * time.Millisecond
+	released, unsubscribe := subscribeRelease(ctx, client, channels)
+	defer unsubscribe()
+	if released != nil {
+		interval = DefaultReleaseFallbackPollInterval
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
-	for range ticker.C {
+	for {
+		// 尝试取锁，订阅成功之前锁可能已经被释放，因此需要先取锁一次
+		err := tryLock(ctx)
+		if err == nil {
+			// 加锁成功，返回结果
+			return nil
+		}
+		// 不可重试类型的错误，直接返回
+		if !IsRetryableErr(err) {
+			return err
+		}
 		select {
 		// ctx 终止了
 		case <-ctx.Done():
 			return fmt.Errorf("lock failed, ctx timeout, err: %w", ctx.Err())
-			// 阻塞等锁达到上限时间
+		// 阻塞等锁达到上限时间
 		case <-timeoutCh:
 			return fmt.Errorf("block waiting time out, err: %w", ErrLockAcquiredByOthers)
-		// 放行
-		default:
+		// 收到锁释放通知
+		case <-released:
+		// 兜底轮询
+		case <-ticker.C:
+		}
+	}
+}
+
+// 按照重试策略轮询取锁，调用前已经取锁失败一次
+func retryLock(ctx context.Context, strategy RetryStrategy, timeoutCh <-chan time.Time,
+	tryLock func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		wait, ok := strategy.Next(attempt)
+		if !ok {
+			return fmt.Errorf("lock failed after %d attempts, err: %w", attempt, ErrLockAcquiredByOthers)
 		}
-		// 尝试取锁
-		err := r.tryLock(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		// ctx 终止了
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("lock failed, ctx timeout, err: %w", ctx.Err())
+		// 阻塞等锁达到上限时间
+		case <-timeoutCh:
+			timer.Stop()
+			return fmt.Errorf("block waiting time out, err: %w", ErrLockAcquiredByOthers)
+		case <-timer.C:
+		}
+		err := tryLock(ctx)
 		if err == nil {
-			// 加锁成功，返回结果
 			return nil
 		}
 		// 不可重试类型的错误，直接返回
@@ -167,25 +392,100 @@ func (r *RedisLock) blockingLock(ctx context.Context) error {
 			return err
 		}
 	}
-	// 不可达
-	return nil
 }
 
-// 解锁，基于 lua 脚本实现操作原子性.
-func (r *RedisLock) Unlock(ctx context.Context) error {
-	defer func() {
-		// 停止看门狗
-		if r.stopDog != nil {
-			r.stopDog()
+// 订阅锁释放通知，返回的 channel 在任一频道收到通知时可读，以及取消订阅的函数
+// 客户端不支持订阅或者订阅失败时返回 nil channel
+func subscribeRelease(ctx context.Context, client LockClient, channels []string) (<-chan struct{}, func()) {
+	psc, ok := client.(PubSubClient)
+	if !ok || len(channels) == 0 {
+		return nil, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	released := make(chan struct{}, 1)
+	started := make(chan error, 1)
+	go func() {
+		err := psc.ListenPubSubChannels(ctx, func() error {
+			started <- nil
+			return nil
+		}, func(string, []byte) error {
+			// 通知合并，等锁方只需要知道锁被释放过
+			select {
+			case released <- struct{}{}:
+			default:
+			}
+			return nil
+		}, channels...)
+		// 订阅失败时通知等锁方，订阅成功后的异常退出由兜底轮询处理
+		if err == nil {
+			err = errors.New("pub/sub listener exited")
+		}
+		select {
+		case started <- err:
+		default:
 		}
 	}()
-	keysAndArgs := []interface{}{r.getLockKey(), r.token}
-	reply, err := r.client.Eval(ctx, LuaCheckAndDeleteDistributedLock, 1, keysAndArgs)
+	select {
+	case err := <-started:
+		if err != nil {
+			cancel()
+			return nil, func() {}
+		}
+	case <-ctx.Done():
+		cancel()
+		return nil, func() {}
+	}
+	return released, cancel
+}
+
+// 解锁，基于 lua 脚本实现操作原子性.
+func (r *RedisLock) Unlock(ctx context.Context) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisLock.Unlock", trace.WithAttributes(attrLockKey.String(r.getLockKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeReleased, err), err) }()
+	if r.reentrantMode {
+		return r.reentrantUnlock(ctx)
+	}
+	// 停止看门狗
+	defer r.release()
+	keysAndArgs := []interface{}{r.getLockKey(), r.token, r.getChannel()}
+	reply, err := r.eval(ctx, LuaCheckAndDeleteDistributedLock, 1, keysAndArgs, nil)
 	if err != nil {
 		return err
 	}
 	if ret, _ := reply.(int64); ret != 1 {
-		return errors.New("can not unlock without ownership of lock")
+		return fmt.Errorf("can not unlock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 可重入锁解锁，重入次数减到零时才真正释放锁并停止看门狗
+func (r *RedisLock) reentrantUnlock(ctx context.Context) error {
+	keysAndArgs := []interface{}{r.getLockKey(), r.token, r.getChannel()}
+	reply, err := r.eval(ctx, LuaReentrantUnlock, 1, keysAndArgs, nil)
+	if err != nil {
+		r.release()
+		return err
+	}
+	count, _ := reply.(int64)
+	if count < 0 {
+		r.release()
+		return fmt.Errorf("can not unlock, err: %w", ErrLockNotOwned)
+	}
+	r.reentrantCount = count
+	if count == 0 {
+		r.release()
 	}
 	return nil
 }
+
+// 停止看门狗，并结束本次持有锁的状态
+func (r *RedisLock) release() {
+	r.dog.stop()
+	if !r.lockedAt.IsZero() {
+		r.metrics.released(time.Since(r.lockedAt))
+		r.lockedAt = time.Time{}
+	}
+	if r.lease != nil {
+		r.lease.release()
+	}
+}
@@ -3,29 +3,38 @@ package redis_distributed_lock
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"redis_distributed_lock/redistest"
 )
 
+// 创建内存客户端，测试结束时关闭
+func newMemoryClient(t *testing.T, clock redistest.Clock) *redistest.MemoryClient {
+	t.Helper()
+	client, err := redistest.NewMemoryClient(clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
 // 阻塞分布式锁测试
 func Test_blockingLock(t *testing.T) {
-	// 请输入 redis 节点的地址和密码
-	addr := "127.0.0.1:6379"
-	passwd := ""
-	client := NewClient("tcp", addr, passwd)
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
 	lock1 := NewRedisLock("test_key", client, SetExpireSeconds(1))
 	lock2 := NewRedisLock("test_key", client, ActiveBlockMode(), SetBlockWaitingSeconds(2))
 	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := lock1.Lock(ctx); err != nil {
-			t.Error(err)
-			return
-		}
-	}()
-	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		if err := lock2.Lock(ctx); err != nil {
@@ -33,36 +42,430 @@ func Test_blockingLock(t *testing.T) {
 			return
 		}
 	}()
+	// lock1 过期后 lock2 取锁成功
+	time.Sleep(100 * time.Millisecond)
+	clock.Advance(time.Second)
 	wg.Wait()
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
 	t.Log("success")
 }
 
 // 非阻塞分布式锁
 func Test_nonblockingLock(t *testing.T) {
-	// 请输入 redis 节点的地址和密码
-	addr := "127.0.0.1:6379"
-	passwd := ""
-	client := NewClient("tcp", addr, passwd)
+	client := newMemoryClient(t, nil)
 	lock1 := NewRedisLock("test_key", client, SetExpireSeconds(1))
 	lock2 := NewRedisLock("test_key", client)
 	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	t.Log("success")
+}
+
+// 锁过期后可以被其他人获取，原持有者无法再解锁
+func Test_lockExpire(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	lock1 := NewRedisLock("test_expire_key", client, SetExpireSeconds(5))
+	lock2 := NewRedisLock("test_expire_key", client, SetExpireSeconds(5))
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(4 * time.Second)
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	clock.Advance(time.Second)
+	if err := lock2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock1.Unlock(ctx); err == nil || !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 看门狗持续续期，锁不会在初始过期时间后失效
+func Test_watchDogRenew(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	lock1 := NewRedisLock("test_watch_dog_key", client)
+	lock1.watchDogStep = 1
+	lock2 := NewRedisLock("test_watch_dog_key", client)
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 临近过期时等待看门狗续期，续期后越过初始的过期时间
+	clock.Advance(time.Duration(DefaultDistributedLockExpireSeconds-1) * time.Second)
+	time.Sleep(1500 * time.Millisecond)
+	clock.Advance(2 * time.Second)
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	select {
+	case <-lock1.Lost():
+		t.Error("expect lock not lost while watch dog renewing")
+	default:
+	}
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 可重入分布式锁
+func Test_reentrantLock(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock1 := NewRedisLock("test_reentrant_key", client, ActiveReentrantMode(), SetExpireSeconds(5))
+	lock2 := NewRedisLock("test_reentrant_key", client, ActiveReentrantMode(), SetExpireSeconds(5))
+	ctx := context.Background()
+	// 同一 token 重复加锁
+	for i := 0; i < 2; i++ {
+		if err := lock1.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	// 重入次数未归零前，锁仍然被持有
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock1.Unlock(ctx); err == nil {
+		t.Error("expect err when unlock without ownership")
+	}
+	if err := lock2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 同一个 key 被可重入锁、非可重入锁混用时，返回锁被他人持有而不是类型错误
+func Test_reentrantLockMixedMode(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	plain := NewRedisLock("test_mixed_key", client, SetExpireSeconds(5), SetOwnerToken("plain"))
+	reentrant := NewRedisLock("test_mixed_key", client, ActiveReentrantMode(), SetExpireSeconds(5), SetOwnerToken("reentrant"))
+	ctx := context.Background()
+	if err := plain.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reentrant.Lock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := reentrant.DelayExpire(ctx, 10); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := reentrant.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := plain.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reentrant.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Lock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := plain.DelayExpire(ctx, 10); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := plain.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := reentrant.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 公平分布式锁，阻塞等锁者按到达顺序获取锁
+func Test_fairLock(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_fair_key", client, ActiveFairMode(), SetExpireSeconds(5))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var order []int
 	var wg sync.WaitGroup
-	wg.Add(1)
+	for i := 0; i < 3; i++ {
+		waiter := NewRedisLock("test_fair_key", client, ActiveFairMode(), SetExpireSeconds(5),
+			ActiveBlockMode(), SetBlockWaitingSeconds(5))
+		waiter.token = fmt.Sprintf("%s_waiter%d", waiter.token, i)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := waiter.Lock(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			if err := waiter.Unlock(ctx); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		// 保证等锁者依次入队
+		time.Sleep(100 * time.Millisecond)
+	}
+	// 有等锁者排队时，非阻塞加锁也需要排队
+	other := NewRedisLock("test_fair_key", client, ActiveFairMode(), SetExpireSeconds(5))
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	wg.Wait()
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("got order: %v, expect arrival order", order)
+		}
+	}
+	t.Log("success")
+}
+
+// 阻塞等锁通过锁释放通知及时取锁
+func Test_blockingLockReleaseNotify(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_notify_key", client, SetExpireSeconds(10))
+	waiter := NewRedisLock("test_notify_key", client, SetExpireSeconds(10), ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
 	go func() {
-		defer wg.Done()
-		if err := lock1.Lock(ctx); err != nil {
+		// 等待等锁方完成订阅
+		time.Sleep(200 * time.Millisecond)
+		if err := holder.Unlock(ctx); err != nil {
 			t.Error(err)
-			return
 		}
 	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := lock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
-			t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
-			return
+	start := time.Now()
+	if err := waiter.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 收到通知后取锁，不需要等待兜底轮询
+	if cost := time.Since(start); cost >= 200*time.Millisecond+DefaultReleaseFallbackPollInterval {
+		t.Errorf("got cost: %v, expect release notified before fallback poll", cost)
+	}
+	if err := waiter.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// fencing token 随每次加锁严格递增，重入时保持不变
+func Test_fencingToken(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock1 := NewRedisLock("test_fencing_key", client, SetExpireSeconds(5))
+	lock2 := NewRedisLock("test_fencing_key", client, SetExpireSeconds(5))
+	ctx := context.Background()
+	token1, err := lock1.LockWithToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	token2, err := lock2.LockWithToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if token2 <= token1 {
+		t.Errorf("got token: %d, expect greater than %d", token2, token1)
+	}
+	reentrant := NewRedisLock("test_fencing_key", client, ActiveReentrantMode(), SetExpireSeconds(5))
+	token3, err := reentrant.LockWithToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token4, err := reentrant.LockWithToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token3 <= token2 || token4 != token3 {
+		t.Errorf("got tokens: %d, %d, expect reentrant token greater than %d and unchanged", token3, token4, token2)
+	}
+	for i := 0; i < 2; i++ {
+		if err := reentrant.Unlock(ctx); err != nil {
+			t.Fatal(err)
 		}
-	}()
-	wg.Wait()
+	}
+	t.Log("success")
+}
+
+// 调用方指定的持有者 token
+func Test_ownerToken(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock1 := NewRedisLock("test_owner_key", client, SetExpireSeconds(5), SetOwnerToken("test_owner"))
+	lock2 := NewRedisLock("test_owner_key", client, SetExpireSeconds(5))
+	lock3 := NewRedisLock("test_owner_key", client, SetExpireSeconds(5), SetOwnerToken("test_owner"))
+	if !strings.HasPrefix(lock2.token, GetProcessToken()) {
+		t.Errorf("got token: %s, expect global unique token", lock2.token)
+	}
+	// 同一协程内创建的锁实例是不同的持有者
+	if other := NewRedisLock("test_owner_key", client); other.token == lock2.token {
+		t.Errorf("got same token: %s, expect unique token per lock", other.token)
+	}
+	ctx := context.Background()
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock2.Unlock(ctx); err == nil {
+		t.Error("expect err when unlock without ownership")
+	}
+	// 相同 token 的持有者视为同一个持有者
+	if err := lock3.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 锁到期未解锁时通知锁丢失
+func Test_lockLostOnExpire(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock := NewRedisLock("test_lost_expire_key", client, SetExpireSeconds(1))
+	lockCtx, err := lock.LockContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expect lock ctx canceled when lock expired")
+	}
+	if cause := context.Cause(lockCtx); !errors.Is(cause, ErrLockLost) {
+		t.Errorf("got cause: %v, expect: %v", cause, ErrLockLost)
+	}
+	t.Log("success")
+}
+
+// 看门狗续期时发现锁已不归属自己，通知锁丢失
+func Test_lockLostOnOwnershipViolation(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock := NewRedisLock("test_lost_owner_key", client)
+	lock.watchDogStep = 1
+	ctx := context.Background()
+	lockCtx, err := lock.LockContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 锁被其他人删除
+	if err := client.Del(ctx, lock.getLockKey()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Lost():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expect lock lost when ownership violated")
+	}
+	<-lockCtx.Done()
+	if cause := context.Cause(lockCtx); !errors.Is(cause, ErrLockLost) {
+		t.Errorf("got cause: %v, expect: %v", cause, ErrLockLost)
+	}
+	t.Log("success")
+}
+
+// 加锁时的 ctx 在解锁之前终止，看门狗停止续期，通知锁丢失
+func Test_lockLostOnCtxDone(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock := NewRedisLock("test_lost_ctx_key", client)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expect lock lost when watchdog ctx is done")
+	}
+	if err := lock.lease.Err(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockLost)
+	}
+	t.Log("success")
+}
+
+// 锁丢失后重新加锁，结束之前的持有状态，之前的 lockCtx 被取消
+func Test_relockAfterLost(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	lock := NewRedisLock("test_relock_key", client, SetExpireSeconds(1))
+	ctx := context.Background()
+	lockCtx, err := lock.LockContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// redis 中的锁过期，但非看门狗模式下的到期通知尚未触发
+	clock.Advance(2 * time.Second)
+	lease := lock.lease
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lease.released:
+	default:
+		t.Error("expect previous lease released")
+	}
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect previous lock ctx canceled")
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 主动解锁时取消 lockCtx，但不通知锁丢失
+func Test_lockContextUnlock(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	lock := NewRedisLock("test_lock_ctx_key", client)
+	ctx := context.Background()
+	lockCtx, err := lock.LockContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-lockCtx.Done()
+	if cause := context.Cause(lockCtx); !errors.Is(cause, context.Canceled) {
+		t.Errorf("got cause: %v, expect: %v", cause, context.Canceled)
+	}
+	select {
+	case <-lock.Lost():
+		t.Error("expect lock not lost after unlock")
+	default:
+	}
 	t.Log("success")
 }
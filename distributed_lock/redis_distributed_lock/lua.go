@@ -1,14 +1,37 @@
 package redis_distributed_lock
 
-// 判断是否拥有分布式锁的归属权，是则删除
+// 加锁，锁不存在时加锁成功，并在同一脚本内递增该锁的 fencing token
+// 返回本次加锁获得的 fencing token，加锁失败时返回 0
+const LuaLock = `
+	local lockerKey = KEYS[1]
+	local fencingKey = KEYS[2]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	if (redis.call('set', lockerKey, targetToken, 'NX', 'EX', duration)) then
+		return redis.call('incr', fencingKey)
+	else
+		return 0
+	end
+`
+
+// 判断是否拥有分布式锁的归属权，是则删除，并在指定了频道时发布锁释放通知
+// 锁被可重入锁持有（hash）时视为不拥有归属权
 const LuaCheckAndDeleteDistributedLock = `
 	local lockerKey = KEYS[1]
 	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	if (redis.call('type', lockerKey)['ok'] ~= 'string') then
+		return 0
+	end
 	local getToken = redis.call('get', lockerKey)
 	if (not getToken or getToken ~= targetToken) then
 		return 0
 	else
-		return redis.call('del', lockerKey)
+		local ret = redis.call('del', lockerKey)
+		if (channel) then
+			redis.call('publish', channel, targetToken)
+		end
+		return ret
 	end
 `
 
@@ -17,6 +40,9 @@ const LuaCheckAndExpiredDistributedLock = `
 	local lockerKey = KEYS[1]
 	local targetToken = ARGV[1]
 	local duration = ARGV[2]
+	if (redis.call('type', lockerKey)['ok'] ~= 'string') then
+		return 0
+	end
 	local getToken = redis.call('get', lockerKey)
 	if (not getToken or getToken ~= targetToken) then
 		return 0
@@ -24,3 +50,464 @@ const LuaCheckAndExpiredDistributedLock = `
 		return redis.call('expire', lockerKey, duration)
 	end
 `
+
+// 可重入锁加锁，锁不存在或者归属于自己时，对应 token 的重入次数加一并续期
+// 首次加锁时递增 fencing token，重入时沿用首次加锁获得的 fencing token
+// 返回 {重入次数, fencing token}，加锁失败时返回 {0, 0}，锁被非可重入锁持有（string）时同样加锁失败
+const LuaReentrantLock = `
+	local lockerKey = KEYS[1]
+	local fencingKey = KEYS[2]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	local keyType = redis.call('type', lockerKey)['ok']
+	if (keyType == 'none' or (keyType == 'hash' and redis.call('hexists', lockerKey, targetToken) == 1)) then
+		local count = redis.call('hincrby', lockerKey, targetToken, 1)
+		redis.call('expire', lockerKey, duration)
+		local fencingToken
+		if (count == 1) then
+			fencingToken = redis.call('incr', fencingKey)
+		else
+			fencingToken = tonumber(redis.call('get', fencingKey) or 0)
+		end
+		return {count, fencingToken}
+	else
+		return {0, 0}
+	end
+`
+
+// 可重入锁解锁，判断是否拥有分布式锁的归属权，是则重入次数减一，减到零时删除锁并发布锁释放通知
+// 返回剩余的重入次数，不拥有归属权时返回 -1
+const LuaReentrantUnlock = `
+	local lockerKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	if (redis.call('type', lockerKey)['ok'] ~= 'hash' or redis.call('hexists', lockerKey, targetToken) == 0) then
+		return -1
+	end
+	local count = redis.call('hincrby', lockerKey, targetToken, -1)
+	if (count <= 0) then
+		redis.call('del', lockerKey)
+		if (channel) then
+			redis.call('publish', channel, targetToken)
+		end
+		return 0
+	end
+	return count
+`
+
+// 判断是否拥有可重入锁的归属权，然后续签
+const LuaCheckAndExpiredReentrantLock = `
+	local lockerKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	if (redis.call('type', lockerKey)['ok'] ~= 'hash' or redis.call('hexists', lockerKey, targetToken) == 0) then
+		return 0
+	else
+		return redis.call('expire', lockerKey, duration)
+	end
+`
+
+// 读锁加锁，写锁未被持有且没有等待中的写锁时，记录读锁持有者及其过期时间
+// 读锁持有者按 token 记录在 zset 中，score 为过期时间戳（毫秒），过期的持有者会被清理
+// 已持有读锁的 token 再次加锁时直接续期，不受等待中的写锁影响
+const LuaRWLockRLock = `
+	local writeKey = KEYS[1]
+	local readersKey = KEYS[2]
+	local writersKey = KEYS[3]
+	local targetToken = ARGV[1]
+	local duration = tonumber(ARGV[2]) * 1000
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	redis.call('zremrangebyscore', readersKey, '-inf', nowMillis)
+	redis.call('zremrangebyscore', writersKey, '-inf', nowMillis)
+	if (redis.call('exists', writeKey) == 1) then
+		return 0
+	end
+	if (redis.call('zcard', writersKey) > 0 and not redis.call('zscore', readersKey, targetToken)) then
+		return 0
+	end
+	redis.call('zadd', readersKey, nowMillis + duration, targetToken)
+	if (redis.call('pttl', readersKey) < duration) then
+		redis.call('pexpire', readersKey, duration)
+	end
+	return 1
+`
+
+// 判断是否持有租约，然后续签，读锁和信号量的持有者均以 zset 记录租约
+const LuaCheckAndExpiredLease = `
+	local readersKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local duration = tonumber(ARGV[2]) * 1000
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	local expireAt = redis.call('zscore', readersKey, targetToken)
+	if (not expireAt or tonumber(expireAt) <= nowMillis) then
+		return 0
+	end
+	redis.call('zadd', readersKey, nowMillis + duration, targetToken)
+	if (redis.call('pttl', readersKey) < duration) then
+		redis.call('pexpire', readersKey, duration)
+	end
+	return 1
+`
+
+// 判断是否持有读锁，是则释放，最后一个读锁释放时发布锁释放通知
+const LuaRWLockRUnlock = `
+	local readersKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	local ret = redis.call('zrem', readersKey, targetToken)
+	if (ret == 1 and redis.call('zcard', readersKey) == 0 and channel) then
+		redis.call('publish', channel, targetToken)
+	end
+	return ret
+`
+
+// 写锁加锁，写锁未被持有且没有有效的读锁持有者时加锁成功
+// 加锁失败时，若指定了等待时长，则登记为等待中的写锁，阻止新的读锁加锁，实现写锁优先
+const LuaRWLockLock = `
+	local writeKey = KEYS[1]
+	local readersKey = KEYS[2]
+	local writersKey = KEYS[3]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	local waitingMillis = tonumber(ARGV[3])
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	redis.call('zremrangebyscore', readersKey, '-inf', nowMillis)
+	redis.call('zremrangebyscore', writersKey, '-inf', nowMillis)
+	if (redis.call('exists', writeKey) == 0 and redis.call('zcard', readersKey) == 0) then
+		redis.call('set', writeKey, targetToken, 'EX', duration)
+		redis.call('zrem', writersKey, targetToken)
+		return 1
+	end
+	if (waitingMillis > 0) then
+		redis.call('zadd', writersKey, nowMillis + waitingMillis, targetToken)
+		if (redis.call('pttl', writersKey) < waitingMillis) then
+			redis.call('pexpire', writersKey, waitingMillis)
+		end
+	end
+	return 0
+`
+
+// 取消写锁的等待登记，并通知被等待中的写锁阻塞的读锁
+const LuaRWLockCancelWaiting = `
+	local writersKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	local ret = redis.call('zrem', writersKey, targetToken)
+	if (ret == 1 and channel) then
+		redis.call('publish', channel, targetToken)
+	end
+	return ret
+`
+
+// 公平锁加锁，锁未被持有且自己位于等锁队列队首（或队列为空）时加锁成功
+// 等锁队列为 zset，score 为入队时间戳（微秒），保证按到达顺序授予锁
+// 等锁者每次尝试都会刷新自己的心跳截止时间（毫秒），心跳过期的等锁者会被清出队列
+// 返回本次加锁获得的 fencing token，加锁失败时返回 0
+const LuaFairLock = `
+	local lockerKey = KEYS[1]
+	local queueKey = KEYS[2]
+	local timeoutKey = KEYS[3]
+	local fencingKey = KEYS[4]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	local waiterTimeout = tonumber(ARGV[3])
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	local nowMicros = tonumber(now[1]) * 1000000 + tonumber(now[2])
+	local staleTokens = redis.call('zrangebyscore', timeoutKey, '-inf', nowMillis)
+	for _, staleToken in ipairs(staleTokens) do
+		redis.call('zrem', queueKey, staleToken)
+		redis.call('zrem', timeoutKey, staleToken)
+	end
+	if (redis.call('exists', lockerKey) == 0) then
+		local head = redis.call('zrange', queueKey, 0, 0)
+		if (#head == 0 or head[1] == targetToken) then
+			redis.call('set', lockerKey, targetToken, 'EX', duration)
+			redis.call('zrem', queueKey, targetToken)
+			redis.call('zrem', timeoutKey, targetToken)
+			return redis.call('incr', fencingKey)
+		end
+	end
+	if (waiterTimeout > 0) then
+		if (not redis.call('zscore', queueKey, targetToken)) then
+			redis.call('zadd', queueKey, nowMicros, targetToken)
+		end
+		redis.call('zadd', timeoutKey, nowMillis + waiterTimeout, targetToken)
+		if (redis.call('pttl', queueKey) < waiterTimeout) then
+			redis.call('pexpire', queueKey, waiterTimeout)
+		end
+		if (redis.call('pttl', timeoutKey) < waiterTimeout) then
+			redis.call('pexpire', timeoutKey, waiterTimeout)
+		end
+	end
+	return 0
+`
+
+// 等锁者放弃等锁，退出公平锁的等锁队列，并通知后续的等锁者
+const LuaFairLockCancelWaiting = `
+	local queueKey = KEYS[1]
+	local timeoutKey = KEYS[2]
+	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	redis.call('zrem', timeoutKey, targetToken)
+	local ret = redis.call('zrem', queueKey, targetToken)
+	if (ret == 1 and channel) then
+		redis.call('publish', channel, targetToken)
+	end
+	return ret
+`
+
+// 信号量加锁，清理租约过期的持有者后，剩余许可数大于零时记录持有者及其租约过期时间（毫秒）
+// 已持有许可的 token 再次加锁时直接续期
+const LuaSemaphoreAcquire = `
+	local semaphoreKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local permits = tonumber(ARGV[2])
+	local duration = tonumber(ARGV[3]) * 1000
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	redis.call('zremrangebyscore', semaphoreKey, '-inf', nowMillis)
+	if (not redis.call('zscore', semaphoreKey, targetToken) and redis.call('zcard', semaphoreKey) >= permits) then
+		return 0
+	end
+	redis.call('zadd', semaphoreKey, nowMillis + duration, targetToken)
+	if (redis.call('pttl', semaphoreKey) < duration) then
+		redis.call('pexpire', semaphoreKey, duration)
+	end
+	return 1
+`
+
+// 判断是否持有信号量许可，是则释放并发布许可释放通知
+const LuaSemaphoreRelease = `
+	local semaphoreKey = KEYS[1]
+	local targetToken = ARGV[1]
+	local channel = ARGV[2]
+	local ret = redis.call('zrem', semaphoreKey, targetToken)
+	if (ret == 1 and channel) then
+		redis.call('publish', channel, targetToken)
+	end
+	return ret
+`
+
+// 同时锁定多个 key，全部 key 未被其他 token 持有时一并加锁，否则一个都不加锁
+// ARGV[3] 为 1 时表示当前实例加锁成功且尚未解锁，已经由当前 token 持有的 key 视为可加锁，重复加锁时刷新过期时间；
+// 否则要求全部 key 均未被持有，避免接管相同 token 的其他锁持有的 key
+const LuaMultiLock = `
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	local relock = ARGV[3] == '1'
+	for _, lockerKey in ipairs(KEYS) do
+		local keyType = redis.call('type', lockerKey)['ok']
+		if (keyType ~= 'none' and (not relock or keyType ~= 'string' or redis.call('get', lockerKey) ~= targetToken)) then
+			return 0
+		end
+	end
+	for _, lockerKey in ipairs(KEYS) do
+		redis.call('set', lockerKey, targetToken, 'EX', duration)
+	end
+	return 1
+`
+
+// 判断是否持有全部 key，是则一并续期
+const LuaMultiCheckAndExpired = `
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	for _, lockerKey in ipairs(KEYS) do
+		if (redis.call('type', lockerKey)['ok'] ~= 'string' or redis.call('get', lockerKey) ~= targetToken) then
+			return 0
+		end
+	end
+	for _, lockerKey in ipairs(KEYS) do
+		redis.call('expire', lockerKey, duration)
+	end
+	return 1
+`
+
+// 删除当前 token 持有的全部 key，并在各自的频道发布锁释放通知，返回删除的 key 数量
+// ARGV[i + 1] 为 KEYS[i] 对应的通知频道
+const LuaMultiUnlock = `
+	local targetToken = ARGV[1]
+	local released = 0
+	for i, lockerKey in ipairs(KEYS) do
+		if (redis.call('type', lockerKey)['ok'] == 'string' and redis.call('get', lockerKey) == targetToken) then
+			redis.call('del', lockerKey)
+			redis.call('publish', ARGV[i + 1], targetToken)
+			released = released + 1
+		end
+	end
+	return released
+`
+
+// 查看锁的类型、剩余过期时间（毫秒）以及持有者，锁不存在时返回空数组
+// 字符串为独占锁的 token，hash 为可重入锁的 token 及重入次数，zset 为读锁、信号量持有者的 token 及租约过期时间戳（毫秒）
+// 同时返回元数据 key 中记录的锁持有者元数据
+const LuaInspectLock = `
+	local lockerKey = KEYS[1]
+	local metadataKey = KEYS[2]
+	local keyType = redis.call('type', lockerKey)['ok']
+	if (keyType == 'none') then
+		return {}
+	end
+	local pttl = redis.call('pttl', lockerKey)
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	local owners = {}
+	if (keyType == 'string') then
+		owners = {redis.call('get', lockerKey), '0'}
+	elseif (keyType == 'hash') then
+		owners = redis.call('hgetall', lockerKey)
+	elseif (keyType == 'zset') then
+		owners = redis.call('zrange', lockerKey, 0, -1, 'WITHSCORES')
+	end
+	return {keyType, pttl, nowMillis, owners, redis.call('hgetall', metadataKey)}
+`
+
+// 判断 key 是否为锁的派生 key，KEYS 依次为 key、key 的 fencing token 计数器、去掉后缀后的锁 key 及其 fencing token 计数器、读锁 key
+// key 的类型与派生 key 不一致，或者 key 本身作为锁加过锁（存在 fencing token 计数器）时不是派生 key；
+// fencing token 计数器在锁释放后仍然保留，以值是否为整数判断；其他派生 key 在去掉后缀后的锁存在或者曾经加过锁时是派生 key
+const LuaIsDerivedKey = `
+	local keyType = redis.call('type', KEYS[1])['ok']
+	if (keyType ~= ARGV[1] or redis.call('exists', KEYS[2]) == 1) then
+		return 0
+	end
+	if (KEYS[1] == KEYS[4]) then
+		if (tonumber(redis.call('get', KEYS[1]))) then
+			return 1
+		end
+		return 0
+	end
+	if (redis.call('exists', KEYS[3], KEYS[4], KEYS[5]) > 0) then
+		return 1
+	end
+	return 0
+`
+
+// 强制删除锁及其元数据，并发布锁释放通知唤醒等锁者，不删除 fencing token 计数器，保证 fencing token 严格递增
+const LuaForceRelease = `
+	local lockerKey = KEYS[1]
+	local metadataKey = KEYS[2]
+	local channel = ARGV[1]
+	local ret = redis.call('del', lockerKey)
+	redis.call('del', metadataKey)
+	if (ret == 1) then
+		redis.call('publish', channel, '')
+	end
+	return ret
+`
+
+// 查看锁的持有者及其剩余过期时间（毫秒），锁不存在时返回空数组
+// 锁被可重入锁持有（hash）时，持有者为 hash 中的 token
+const LuaLockHolder = `
+	local lockerKey = KEYS[1]
+	local keyType = redis.call('type', lockerKey)['ok']
+	local token
+	if (keyType == 'string') then
+		token = redis.call('get', lockerKey)
+	elseif (keyType == 'hash') then
+		token = redis.call('hkeys', lockerKey)[1]
+	end
+	if (not token) then
+		return {}
+	end
+	return {token, redis.call('pttl', lockerKey)}
+`
+
+// 锁元数据的维护逻辑，追加在 RedisLock 的加锁、续期、解锁脚本之后，与原脚本在同一个脚本内原子执行
+// 原脚本的 KEYS[1] 为锁 key、ARGV[1] 为 token，元数据 key 追加在 KEYS 末尾，
+// 元数据的字段、值追加在 ARGV 末尾，ARGV 最后一项为字段数量，续期、解锁时为 0
+// 锁由当前 token 持有时，元数据不属于当前 token 则重新写入，并与锁的过期时间保持一致；锁不存在时删除元数据
+const luaLockMetadataEpilogue = `
+local lockerKey = KEYS[1]
+local metadataKey = KEYS[#KEYS]
+local targetToken = ARGV[1]
+local fieldCount = tonumber(ARGV[#ARGV])
+local keyType = redis.call('type', lockerKey)['ok']
+if (keyType == 'none') then
+	redis.call('del', metadataKey)
+elseif ((keyType == 'string' and redis.call('get', lockerKey) == targetToken) or
+		(keyType == 'hash' and redis.call('hexists', lockerKey, targetToken) == 1)) then
+	if (fieldCount > 0 and redis.call('hget', metadataKey, 'token') ~= targetToken) then
+		redis.call('del', metadataKey)
+		redis.call('hset', metadataKey, 'token', targetToken)
+		for i = #ARGV - 2 * fieldCount, #ARGV - 1, 2 do
+			redis.call('hset', metadataKey, ARGV[i], ARGV[i + 1])
+		end
+	end
+	local pttl = redis.call('pttl', lockerKey)
+	if (pttl > 0) then
+		redis.call('pexpire', metadataKey, pttl)
+	end
+end
+return ret
+`
+
+// 在脚本之后维护锁的元数据
+func withLockMetadata(src string) string {
+	return "local function run()\n" + src + "\nend\nlocal ret = run()\n" + luaLockMetadataEpilogue
+}
+
+// 锁由当前 token 持有时，将持有者改为新 token，保留锁的剩余过期时间以及可重入锁的重入次数
+// 同时删除原持有者的元数据，并递增 fencing token，使原持有者的 fencing token 失效
+// 返回新的 fencing token，当前 token 未持有锁时返回 0
+const LuaTransferLock = `
+	local lockerKey = KEYS[1]
+	local fencingKey = KEYS[2]
+	local metadataKey = KEYS[3]
+	local targetToken = ARGV[1]
+	local newToken = ARGV[2]
+	local keyType = redis.call('type', lockerKey)['ok']
+	if (keyType == 'string' and redis.call('get', lockerKey) == targetToken) then
+		local pttl = redis.call('pttl', lockerKey)
+		if (pttl > 0) then
+			redis.call('set', lockerKey, newToken, 'PX', pttl)
+		else
+			redis.call('set', lockerKey, newToken)
+		end
+	elseif (keyType == 'hash' and redis.call('hexists', lockerKey, targetToken) == 1) then
+		-- 先写入新 token 再删除旧 token，避免 hash 被清空后重建而丢失过期时间
+		if (newToken ~= targetToken) then
+			redis.call('hset', lockerKey, newToken, redis.call('hget', lockerKey, targetToken))
+			redis.call('hdel', lockerKey, targetToken)
+		end
+	else
+		return 0
+	end
+	redis.call('del', metadataKey)
+	return redis.call('incr', fencingKey)
+`
+
+// 接管转移给当前 token 的锁并续期，返回 {重入次数, fencing token}，当前 token 未持有锁时返回 {0, 0}
+const LuaAdoptLock = `
+	local lockerKey = KEYS[1]
+	local fencingKey = KEYS[2]
+	local targetToken = ARGV[1]
+	local duration = ARGV[2]
+	local keyType = redis.call('type', lockerKey)['ok']
+	local count
+	if (keyType == 'string' and redis.call('get', lockerKey) == targetToken) then
+		count = 1
+	elseif (keyType == 'hash' and redis.call('hexists', lockerKey, targetToken) == 1) then
+		count = tonumber(redis.call('hget', lockerKey, targetToken))
+	else
+		return {0, 0}
+	end
+	redis.call('expire', lockerKey, duration)
+	return {count, tonumber(redis.call('get', fencingKey) or 0)}
+`
+
+// 读取 key 的值，key 不存在时返回 nil
+const LuaGetValue = `
+	return redis.call('get', KEYS[1])
+`
+
+// 写入 key 的值，过期时间（毫秒）大于 0 时设置过期时间
+const LuaSetValue = `
+	local ttl = tonumber(ARGV[2])
+	if (ttl > 0) then
+		return redis.call('set', KEYS[1], ARGV[1], 'PX', ttl)
+	end
+	return redis.call('set', KEYS[1], ARGV[1])
+`
@@ -0,0 +1,117 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 锁元数据中的字段
+const (
+	metadataFieldToken      = "token"
+	metadataFieldService    = "service"
+	metadataFieldHostname   = "hostname"
+	metadataFieldPurpose    = "purpose"
+	metadataFieldTraceID    = "trace_id"
+	metadataFieldAcquiredAt = "acquired_at"
+)
+
+// 锁持有者的元数据，用于排查锁被哪个服务、主机、请求持有
+type LockMetadata struct {
+	// 持有者的 token，由 Inspect 返回
+	Token string `json:"token,omitempty"`
+	// 服务名称
+	Service string `json:"service,omitempty"`
+	// 主机名，未指定时使用当前主机名
+	Hostname string `json:"hostname,omitempty"`
+	// 加锁的目的
+	Purpose string `json:"purpose,omitempty"`
+	// 加锁请求的 trace ID，加锁的 ctx 中携带 span 时使用该 span 的 trace ID
+	TraceID string `json:"trace_id,omitempty"`
+	// 首次加锁成功的时间，由 Inspect 返回
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// 加锁时将元数据以 hash 记录在 xxx_META 中，与锁在同一个 lua 脚本内写入、续期以及删除，可以通过 Client.Inspect 查看
+// 仅对 RedisLock 生效，redis cluster 模式下锁 key 需要包含哈希标签
+func SetLockMetadata(metadata LockMetadata) LockOption {
+	return func(o *LockOptions) {
+		if metadata.Hostname == "" {
+			metadata.Hostname = GetHostname()
+		}
+		o.metadata = &metadata
+	}
+}
+
+// 元数据 key
+func (r *RedisLock) getMetadataKey() string {
+	return r.getLockKey() + "_META"
+}
+
+// 加锁时写入的元数据字段、值，未开启元数据时返回 nil
+func (r *RedisLock) lockMetadataArgs(ctx context.Context) []interface{} {
+	if r.metadata == nil {
+		return nil
+	}
+	traceID := r.metadata.TraceID
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		traceID = sc.TraceID().String()
+	}
+	args := []interface{}{metadataFieldAcquiredAt, time.Now().UnixMilli()}
+	for _, kv := range [][2]string{
+		{metadataFieldService, r.metadata.Service},
+		{metadataFieldHostname, r.metadata.Hostname},
+		{metadataFieldPurpose, r.metadata.Purpose},
+		{metadataFieldTraceID, traceID},
+	} {
+		if kv[1] != "" {
+			args = append(args, kv[0], kv[1])
+		}
+	}
+	return args
+}
+
+// 执行锁的脚本，开启元数据时在同一个脚本内维护元数据，metadataArgs 为加锁时写入的元数据字段、值
+func (r *RedisLock) eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{},
+	metadataArgs []interface{}) (interface{}, error) {
+	if r.metadata == nil {
+		return r.client.Eval(ctx, src, keyCount, keysAndArgs)
+	}
+	args := make([]interface{}, 0, len(keysAndArgs)+len(metadataArgs)+2)
+	args = append(args, keysAndArgs[:keyCount]...)
+	args = append(args, r.getMetadataKey())
+	args = append(args, keysAndArgs[keyCount:]...)
+	args = append(args, metadataArgs...)
+	args = append(args, len(metadataArgs)/2)
+	return r.client.Eval(ctx, withLockMetadata(src), keyCount+1, args)
+}
+
+// 解析 HGETALL 返回的元数据，元数据不存在时返回 nil
+func parseLockMetadata(fields []string) *LockMetadata {
+	if len(fields) == 0 {
+		return nil
+	}
+	var metadata LockMetadata
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := fields[i+1]
+		switch fields[i] {
+		case metadataFieldToken:
+			metadata.Token = value
+		case metadataFieldService:
+			metadata.Service = value
+		case metadataFieldHostname:
+			metadata.Hostname = value
+		case metadataFieldPurpose:
+			metadata.Purpose = value
+		case metadataFieldTraceID:
+			metadata.TraceID = value
+		case metadataFieldAcquiredAt:
+			if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+				metadata.AcquiredAt = time.UnixMilli(millis)
+			}
+		}
+	}
+	return &metadata
+}
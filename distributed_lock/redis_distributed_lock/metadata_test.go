@@ -0,0 +1,141 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// 元数据与锁一起写入、续期以及删除
+func Test_lockMetadata(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "transfer")
+	defer span.End()
+	lock := NewRedisLock("test_metadata_key", client, SetOwnerToken("token_1"), SetExpireSeconds(10),
+		SetLockMetadata(LockMetadata{Service: "order", Hostname: "host_1", Purpose: "pay order"}))
+	start := time.Now().Truncate(time.Millisecond)
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Inspect(ctx, "test_metadata_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := info.Metadata
+	if m == nil {
+		t.Fatal("expect metadata of lock")
+	}
+	if m.Token != "token_1" || m.Service != "order" || m.Hostname != "host_1" || m.Purpose != "pay order" ||
+		m.TraceID != span.SpanContext().TraceID().String() {
+		t.Errorf("got metadata: %+v", m)
+	}
+	if m.AcquiredAt.Before(start) || m.AcquiredAt.After(time.Now()) {
+		t.Errorf("got acquired at: %v", m.AcquiredAt)
+	}
+	if ttl := mr.TTL(lock.getMetadataKey()); ttl != 10*time.Second {
+		t.Errorf("got metadata ttl: %v, expect: 10s", ttl)
+	}
+	if err := lock.DelayExpire(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(lock.getMetadataKey()); ttl != 20*time.Second {
+		t.Errorf("got metadata ttl: %v, expect: 20s", ttl)
+	}
+
+	// 其他持有者加锁失败时不会覆盖元数据
+	other := NewRedisLock("test_metadata_key", client, SetOwnerToken("token_2"),
+		SetLockMetadata(LockMetadata{Service: "refund"}))
+	if err := other.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if info, _ := client.Inspect(ctx, "test_metadata_key"); info.Metadata.Service != "order" {
+		t.Errorf("got service: %s, expect: order", info.Metadata.Service)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(lock.getMetadataKey()) {
+		t.Error("expect metadata deleted after unlock")
+	}
+	t.Log("success")
+}
+
+// 可重入锁重入时保留首次加锁的元数据，完全解锁后删除
+func Test_reentrantLockMetadata(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	lock := NewRedisLock("test_reentrant_metadata_key", client, SetExpireSeconds(10), ActiveReentrantMode(),
+		SetLockMetadata(LockMetadata{Service: "order"}))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first, err := client.Inspect(ctx, "test_reentrant_metadata_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Inspect(ctx, "test_reentrant_metadata_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Metadata == nil || !second.Metadata.AcquiredAt.Equal(first.Metadata.AcquiredAt) {
+		t.Errorf("got metadata: %+v, expect acquired at: %v", second.Metadata, first.Metadata.AcquiredAt)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists(lock.getMetadataKey()) {
+		t.Error("expect metadata kept while lock is still held")
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(lock.getMetadataKey()) {
+		t.Error("expect metadata deleted after unlock")
+	}
+	t.Log("success")
+}
+
+// 开启元数据时，锁的归属权校验不受影响
+func Test_lockMetadataOwnership(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	metadata := SetLockMetadata(LockMetadata{Service: "order"})
+	for _, opt := range []LockOption{ActiveReentrantMode(), ActiveFairMode(), func(*LockOptions) {}} {
+		holder := NewRedisLock("test_metadata_ownership_key", client, SetOwnerToken("holder"), SetExpireSeconds(5), metadata, opt)
+		other := NewRedisLock("test_metadata_ownership_key", client, SetOwnerToken("other"), SetExpireSeconds(5), metadata, opt)
+		if err := holder.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+			t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+		}
+		if err := other.DelayExpire(ctx, 10); !errors.Is(err, ErrLockNotOwned) {
+			t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+		}
+		if err := other.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+			t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+		}
+		if err := holder.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		exists, err := client.Eval(ctx, "return redis.call('exists', KEYS[1])", 1, []interface{}{holder.getMetadataKey()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != int64(0) {
+			t.Error("expect metadata deleted after unlock")
+		}
+	}
+	t.Log("success")
+}
@@ -0,0 +1,240 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 加锁失败的原因
+const (
+	// 锁被其他人持有，包括阻塞等锁超时
+	FailureReasonAcquiredByOthers = "acquired_by_others"
+	// ctx 终止
+	FailureReasonCtxTimeout = "ctx_timeout"
+	// redis 命令执行失败
+	FailureReasonRedisError = "redis_error"
+)
+
+// 分布式锁的 prometheus 指标，实现了 prometheus.Collector，注册后即可通过 promhttp 暴露，例如在 gin 中：
+//
+//	metrics := NewMetrics("my_service")
+//	prometheus.MustRegister(metrics)
+//	engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+//
+// 通过 SetLockMetrics 为锁开启指标，通过 SetClientMetrics 为客户端开启连接池指标
+type Metrics struct {
+	attempts        prometheus.Counter
+	successes       prometheus.Counter
+	failures        *prometheus.CounterVec
+	waitTime        *prometheus.HistogramVec
+	holdTime        prometheus.Histogram
+	renewals        prometheus.Counter
+	renewalFailures prometheus.Counter
+	poolActive      *prometheus.Desc
+	poolIdle        *prometheus.Desc
+	mu              sync.Mutex
+	// 连接池名称 -> 客户端
+	clients map[string][]*Client
+}
+
+// 创建指标，namespace 为指标名称的前缀
+func NewMetrics(namespace string) *Metrics {
+	const subsystem = "distributed_lock"
+	return &Metrics{
+		attempts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "acquire_attempts_total",
+			Help: "Number of lock acquire attempts, including retries in block mode.",
+		}),
+		successes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "acquire_successes_total",
+			Help: "Number of successful lock acquisitions.",
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "acquire_failures_total",
+			Help: "Number of failed lock acquisitions by reason.",
+		}, []string{"reason"}),
+		waitTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "wait_seconds",
+			Help:    "Time spent acquiring the lock by result.",
+			Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+		}, []string{"result"}),
+		holdTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "hold_seconds",
+			Help:    "Time the lock is held until it is released.",
+			Buckets: []float64{.001, .01, .1, 1, 5, 10, 30, 60, 300, 600},
+		}),
+		renewals: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "watchdog_renewals_total",
+			Help: "Number of successful watchdog renewals.",
+		}),
+		renewalFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: subsystem, Name: "watchdog_renewal_failures_total",
+			Help: "Number of failed watchdog renewals.",
+		}),
+		poolActive: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "pool_active_connections"),
+			"Number of active connections in the redis pool.", []string{"pool"}, nil),
+		poolIdle: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "pool_idle_connections"),
+			"Number of idle connections in the redis pool.", []string{"pool"}, nil),
+		clients: make(map[string][]*Client),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.attempts.Describe(ch)
+	m.successes.Describe(ch)
+	m.failures.Describe(ch)
+	m.waitTime.Describe(ch)
+	m.holdTime.Describe(ch)
+	m.renewals.Describe(ch)
+	m.renewalFailures.Describe(ch)
+	ch <- m.poolActive
+	ch <- m.poolIdle
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.attempts.Collect(ch)
+	m.successes.Collect(ch)
+	m.failures.Collect(ch)
+	m.waitTime.Collect(ch)
+	m.holdTime.Collect(ch)
+	m.renewals.Collect(ch)
+	m.renewalFailures.Collect(ch)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 同名的连接池，统计值累加
+	for name, clients := range m.clients {
+		var active, idle int
+		for _, c := range clients {
+			stats := c.pool.Stats()
+			active += stats.ActiveCount
+			idle += stats.IdleCount
+		}
+		ch <- prometheus.MustNewConstMetric(m.poolActive, prometheus.GaugeValue, float64(active), name)
+		ch <- prometheus.MustNewConstMetric(m.poolIdle, prometheus.GaugeValue, float64(idle), name)
+	}
+}
+
+// 统计客户端连接池的活跃、空闲连接数
+func (m *Metrics) watchClient(c *Client) {
+	if m == nil {
+		return
+	}
+	name := poolName(c)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[name] = append(m.clients[name], c)
+}
+
+// 客户端关闭后不再统计其连接池，同名的连接池全部关闭后不再输出该连接池的指标
+func (m *Metrics) unwatchClient(c *Client) {
+	if m == nil {
+		return
+	}
+	name := poolName(c)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clients := m.clients[name]
+	for i, client := range clients {
+		if client == c {
+			clients = append(clients[:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(clients) == 0 {
+		delete(m.clients, name)
+		return
+	}
+	m.clients[name] = clients
+}
+
+// 连接池指标的名称，哨兵模式下为主节点名称，否则为节点地址
+func poolName(c *Client) string {
+	if c.sentinel != nil {
+		return "sentinel/" + c.sentinel.masterName
+	}
+	return c.address
+}
+
+// 尝试取锁一次
+func (m *Metrics) attempt() {
+	if m == nil {
+		return
+	}
+	m.attempts.Inc()
+}
+
+// 加锁结束，记录结果以及等锁时间
+func (m *Metrics) acquired(err error, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	if err == nil {
+		m.successes.Inc()
+		m.waitTime.WithLabelValues("success").Observe(wait.Seconds())
+		return
+	}
+	m.failures.WithLabelValues(failureReason(err)).Inc()
+	m.waitTime.WithLabelValues("failure").Observe(wait.Seconds())
+}
+
+// 锁被释放，记录持有时间
+func (m *Metrics) released(hold time.Duration) {
+	if m == nil {
+		return
+	}
+	m.holdTime.Observe(hold.Seconds())
+}
+
+// 锁被释放，加锁时间不为零值时记录持有时间并重置加锁时间
+func (m *Metrics) releasedSince(lockedAt *time.Time) {
+	if lockedAt.IsZero() {
+		return
+	}
+	m.released(time.Since(*lockedAt))
+	*lockedAt = time.Time{}
+}
+
+// 包装取锁函数，每次取锁时统计一次尝试
+func (m *Metrics) countAttempts(tryLock func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		m.attempt()
+		return tryLock(ctx)
+	}
+}
+
+// 包装续期函数，统计看门狗续期的结果
+func (m *Metrics) countRenewals(renew func(ctx context.Context, expireSeconds int64) error) func(ctx context.Context, expireSeconds int64) error {
+	return func(ctx context.Context, expireSeconds int64) error {
+		err := renew(ctx, expireSeconds)
+		m.renewed(err)
+		return err
+	}
+}
+
+// 看门狗续期一次
+func (m *Metrics) renewed(err error) {
+	if m == nil {
+		return
+	}
+	if err == nil {
+		m.renewals.Inc()
+		return
+	}
+	m.renewalFailures.Inc()
+}
+
+// 加锁失败的原因
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrLockAcquiredByOthers):
+		return FailureReasonAcquiredByOthers
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return FailureReasonCtxTimeout
+	default:
+		return FailureReasonRedisError
+	}
+}
@@ -0,0 +1,167 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// 加锁、解锁以及看门狗续期的指标
+func Test_lockMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_metrics_key", client, SetLockMetrics(m))
+	holder.watchDogStep = 1
+	waiter := NewRedisLock("test_metrics_key", client, SetExpireSeconds(5), SetLockMetrics(m), ActiveBlockMode(),
+		SetBlockWaitingMillis(100), SetRetryStrategy(FixedIntervalRetry(20*time.Millisecond)))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Lock(ctx); err == nil {
+		t.Fatal("expect err when lock is acquired by others")
+	}
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := waiter.Lock(canceledCtx); err == nil {
+		t.Fatal("expect err when ctx canceled")
+	}
+	// 等待看门狗续期
+	time.Sleep(1200 * time.Millisecond)
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.successes); got != 1 {
+		t.Errorf("got successes: %v, expect: 1", got)
+	}
+	if got := testutil.ToFloat64(m.failures.WithLabelValues(FailureReasonAcquiredByOthers)); got != 1 {
+		t.Errorf("got acquired by others failures: %v, expect: 1", got)
+	}
+	if got := testutil.ToFloat64(m.attempts); got < 4 {
+		t.Errorf("got attempts: %v, expect retries counted", got)
+	}
+	if got := testutil.ToFloat64(m.renewals); got < 1 {
+		t.Errorf("got renewals: %v, expect at least 1", got)
+	}
+	if got := testutil.CollectAndCount(m.holdTime); got != 1 {
+		t.Errorf("got hold time metrics: %d, expect: 1", got)
+	}
+	t.Log("success")
+}
+
+// 信号量、读写锁同样统计加锁、解锁以及看门狗续期的指标
+func Test_semaphoreAndRWLockMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	client := newMemoryClient(t, nil)
+	holder := NewRedisSemaphore("test_metrics_semaphore_key", 1, client, SetLockMetrics(m))
+	holder.watchDogStep = 1
+	waiter := NewRedisSemaphore("test_metrics_semaphore_key", 1, client, SetExpireSeconds(5), SetLockMetrics(m))
+	ctx := context.Background()
+	if err := holder.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.TryAcquire(ctx); err == nil {
+		t.Fatal("expect err when no permits available")
+	}
+	// 等待看门狗续期
+	time.Sleep(1200 * time.Millisecond)
+	if err := holder.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rw := NewRedisRWLock("test_metrics_rw_key", client, SetExpireSeconds(5), SetLockMetrics(m))
+	if err := rw.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.successes); got != 2 {
+		t.Errorf("got successes: %v, expect: 2", got)
+	}
+	if got := testutil.ToFloat64(m.failures.WithLabelValues(FailureReasonAcquiredByOthers)); got != 1 {
+		t.Errorf("got acquired by others failures: %v, expect: 1", got)
+	}
+	if got := testutil.ToFloat64(m.attempts); got != 3 {
+		t.Errorf("got attempts: %v, expect: 3", got)
+	}
+	if got := testutil.ToFloat64(m.renewals); got < 1 {
+		t.Errorf("got renewals: %v, expect at least 1", got)
+	}
+	var hold dto.Metric
+	if err := m.holdTime.Write(&hold); err != nil {
+		t.Fatal(err)
+	}
+	if got := hold.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("got hold time samples: %d, expect: 2", got)
+	}
+	t.Log("success")
+}
+
+// ctx 终止以及 redis 错误导致的加锁失败
+func Test_lockMetricsFailureReason(t *testing.T) {
+	m := NewMetrics("test")
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetClientMetrics(m))
+	lock := NewRedisLock("test_metrics_reason_key", client, SetExpireSeconds(5), SetLockMetrics(m))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lock.Lock(ctx); err == nil {
+		t.Fatal("expect err when ctx canceled")
+	}
+	mr.Close()
+	if err := lock.Lock(context.Background()); err == nil {
+		t.Fatal("expect err when redis is down")
+	}
+	if got := testutil.ToFloat64(m.failures.WithLabelValues(FailureReasonCtxTimeout)); got != 1 {
+		t.Errorf("got ctx timeout failures: %v, expect: 1", got)
+	}
+	if got := testutil.ToFloat64(m.failures.WithLabelValues(FailureReasonRedisError)); got != 1 {
+		t.Errorf("got redis error failures: %v, expect: 1", got)
+	}
+	t.Log("success")
+}
+
+// 连接池的活跃、空闲连接数，客户端关闭后不再输出
+func Test_poolMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetClientMetrics(m), SetMaxIdleLinks(2))
+	if _, err := client.SetNEX(context.Background(), "test_metrics_pool_key", "value", 5); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+	// 读取该客户端连接池的空闲连接数，不存在时返回 -1
+	idle := func() float64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			if family.GetName() != "test_distributed_lock_pool_idle_connections" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				if metric.GetLabel()[0].GetValue() == mr.Addr() {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+		return -1
+	}
+	if got := idle(); got != 1 {
+		t.Errorf("got idle connections: %v, expect: 1", got)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := idle(); got != -1 {
+		t.Errorf("got idle connections: %v, expect no metrics after close", got)
+	}
+	t.Log("success")
+}
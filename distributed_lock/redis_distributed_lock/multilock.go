@@ -0,0 +1,200 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 同时锁定多个 key 的分布式锁，例如转账时同时锁定转出、转入两个账户
+// 所有 key 在同一个 lua 脚本内一并加锁、续期、解锁，不会出现只锁定部分 key 的情况，
+// key 按照字典序排列，多个 token 以不同的顺序锁定同一组 key 时也不会死锁
+// 每个 key 与 RedisLock 使用相同的 key 以及通知频道，因此与锁定单个 key 的 RedisLock 互斥
+// redis cluster 模式下，所有 key 需要包含相同的哈希标签，例如 {account}_1、{account}_2
+type RedisMultiLock struct {
+	LockOptions
+	keys   []string
+	client LockClient
+	dog    watchDog
+	// 本次持有锁期间的状态，未持有锁时为 nil
+	lease *lockLease
+	// 加锁时间，用于统计持有时间
+	lockedAt time.Time
+}
+
+// 初始化，重复的 key 只锁定一次
+func NewRedisMultiLock(keys []string, client LockClient, opts ...LockOption) *RedisMultiLock {
+	seen := make(map[string]struct{}, len(keys))
+	sorted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	m := RedisMultiLock{
+		keys:   sorted,
+		client: client,
+	}
+	for _, opt := range opts {
+		opt(&m.LockOptions)
+	}
+	checkLockOptions(&m.LockOptions)
+	return &m
+}
+
+// lock keys，与 RedisLock 的 key 相同
+func (m *RedisMultiLock) getLockKeys() []interface{} {
+	keys := make([]interface{}, 0, len(m.keys))
+	for _, key := range m.keys {
+		keys = append(keys, m.lockKey(key))
+	}
+	return keys
+}
+
+// 各个 key 的锁释放通知频道，与 RedisLock 的频道相同
+func (m *RedisMultiLock) getChannels() []string {
+	channels := make([]string, 0, len(m.keys))
+	for _, key := range m.keys {
+		channels = append(channels, m.lockKey(key)+"_CHANNEL")
+	}
+	return channels
+}
+
+// 加锁，阻塞模式下等待全部 key 可用
+func (m *RedisMultiLock) Lock(ctx context.Context) (err error) {
+	spanCtx, span := m.tracer.Start(ctx, "RedisMultiLock.Lock", trace.WithAttributes(
+		attrLockKey.StringSlice(m.keys), attrBlockMode.Bool(m.blockMode)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = acquire(spanCtx, "RedisMultiLock.blockingLock", &m.LockOptions, m.client, m.getChannels(),
+		m.metrics.countAttempts(m.tryLock))
+	m.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+	m.watchDog(ctx)
+	return nil
+}
+
+// 尝试加锁一次，不论是否为阻塞模式
+func (m *RedisMultiLock) TryLock(ctx context.Context) (err error) {
+	spanCtx, span := m.tracer.Start(ctx, "RedisMultiLock.TryLock", trace.WithAttributes(
+		attrLockKey.StringSlice(m.keys), attrBlockMode.Bool(false)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = m.metrics.countAttempts(m.tryLock)(spanCtx)
+	m.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+	m.watchDog(ctx)
+	return nil
+}
+
+// 尝试获取全部 key
+func (m *RedisMultiLock) tryLock(ctx context.Context) error {
+	if len(m.keys) == 0 {
+		return errors.New("no key to lock")
+	}
+	// 只有本实例加锁成功且尚未解锁时（包括锁丢失后），才可以沿用当前 token 持有的 key
+	var relock int
+	if m.lease != nil {
+		relock = 1
+	}
+	keysAndArgs := append(m.getLockKeys(), m.token, m.expireSeconds, relock)
+	reply, err := m.client.Eval(ctx, LuaMultiLock, len(m.keys), keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("reply: %d, err: %w", ret, ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 是否仍持有锁，锁丢失后需要重新加锁
+func (m *RedisMultiLock) held() bool {
+	return m.lease != nil && m.lease.Err() == nil
+}
+
+// 开启watchDog，重复加锁时看门狗已经在运行
+func (m *RedisMultiLock) watchDog(ctx context.Context) {
+	held := m.held()
+	if !held {
+		// 锁丢失后重新加锁时，先结束之前的持有状态，之后重新启动看门狗
+		m.release()
+		m.lease = newLockLease()
+		m.lockedAt = time.Now()
+	}
+	// 非看门狗模式下，锁到期后视为锁丢失，重复加锁时锁的过期时间会被刷新
+	if !m.watchDogMode {
+		m.lease.expireAfter(time.Duration(m.expireSeconds) * time.Second)
+		return
+	}
+	if !held {
+		m.dog.start(ctx, m.watchDogStep, m.metrics.countRenewals(m.DelayExpire), m.lease.markLost)
+	}
+}
+
+// 锁丢失通知，看门狗续期因为任一 key 已不归属自己而失败、持续续期失败直到锁过期、加锁时的 ctx 在解锁之前终止，
+// 或者非看门狗模式下锁到期仍未解锁时，channel 会被关闭。未持有锁时返回 nil
+func (m *RedisMultiLock) Lost() <-chan struct{} {
+	if m.lease == nil {
+		return nil
+	}
+	return m.lease.lost
+}
+
+// 更新全部 key 的过期时间，任一 key 已不归属自己时不续期并返回 ErrLockNotOwned
+func (m *RedisMultiLock) DelayExpire(ctx context.Context, expireSeconds int64) (err error) {
+	ctx, span := m.tracer.Start(ctx, "RedisMultiLock.DelayExpire", trace.WithAttributes(
+		attrLockKey.StringSlice(m.keys), attrExpireSeconds.Int64(expireSeconds)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeRenewed, err), err) }()
+	keysAndArgs := append(m.getLockKeys(), m.token, expireSeconds)
+	reply, err := m.client.Eval(ctx, LuaMultiCheckAndExpired, len(m.keys), keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not expire multi lock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 解锁，一并删除仍由自己持有的 key，部分 key 已不归属自己时返回 ErrLockNotOwned
+func (m *RedisMultiLock) Unlock(ctx context.Context) (err error) {
+	ctx, span := m.tracer.Start(ctx, "RedisMultiLock.Unlock", trace.WithAttributes(attrLockKey.StringSlice(m.keys)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeReleased, err), err) }()
+	// 停止看门狗
+	defer m.release()
+	keysAndArgs := m.getLockKeys()
+	keysAndArgs = append(keysAndArgs, m.token)
+	for _, channel := range m.getChannels() {
+		keysAndArgs = append(keysAndArgs, channel)
+	}
+	reply, err := m.client.Eval(ctx, LuaMultiUnlock, len(m.keys), keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != int64(len(m.keys)) {
+		return fmt.Errorf("released %d of %d keys, err: %w", ret, len(m.keys), ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 结束本次持有锁的状态，停止看门狗
+func (m *RedisMultiLock) release() {
+	m.dog.stop()
+	m.metrics.releasedSince(&m.lockedAt)
+	if m.lease != nil {
+		m.lease.release()
+		m.lease = nil
+	}
+}
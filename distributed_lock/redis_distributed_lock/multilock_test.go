@@ -0,0 +1,205 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 部分 key 被其他人持有时一个 key 都不锁定
+func Test_multiLockAllOrNothing(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	single := NewRedisLock("account_2", client, SetExpireSeconds(5), SetOwnerToken("single"))
+	if err := single.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	multi := NewRedisMultiLock([]string{"account_1", "account_2"}, client, SetExpireSeconds(5))
+	if err := multi.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	// account_1 没有被锁定
+	other := NewRedisLock("account_1", client, SetExpireSeconds(5), SetOwnerToken("other"))
+	if err := other.TryLock(ctx); err != nil {
+		t.Fatalf("account_1 is partially locked, err: %v", err)
+	}
+	if err := other.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := single.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := multi.TryLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := multi.DelayExpire(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := multi.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock(ctx); err != nil {
+		t.Errorf("account_1 is not released, err: %v", err)
+	}
+	t.Log("success")
+}
+
+// 阻塞模式下等待全部 key 被释放
+func Test_multiLockBlocking(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	single := NewRedisLock("account_2", client, SetExpireSeconds(5), SetOwnerToken("single"))
+	if err := single.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	multi := NewRedisMultiLock([]string{"account_2", "account_1"}, client, SetExpireSeconds(5),
+		ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := single.Unlock(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	start := time.Now()
+	if err := multi.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 通过 account_2 的锁释放通知唤醒，无需等到兜底轮询
+	if cost := time.Since(start); cost >= DefaultReleaseFallbackPollInterval {
+		t.Errorf("multi lock acquired after %v", cost)
+	}
+	if err := multi.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 以不同顺序锁定同一组 key 不会死锁
+func Test_multiLockOrdering(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var holders int
+	for _, keys := range [][]string{{"from", "to"}, {"to", "from"}} {
+		wg.Add(1)
+		go func(keys []string) {
+			defer wg.Done()
+			multi := NewRedisMultiLock(keys, client, SetExpireSeconds(5), ActiveBlockMode(), SetBlockWaitingSeconds(3))
+			for j := 0; j < 20; j++ {
+				if err := multi.Lock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				holders++
+				if holders > 1 {
+					t.Error("multi lock is held by more than one token")
+				}
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				holders--
+				mu.Unlock()
+				if err := multi.Unlock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(keys)
+	}
+	wg.Wait()
+	t.Log("success")
+}
+
+// 部分 key 丢失后续期失败、解锁仍会释放剩余的 key
+func Test_multiLockPartiallyLost(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	multi := NewRedisMultiLock([]string{"account_1", "account_2"}, client, SetExpireSeconds(5))
+	if err := multi.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Del(ctx, LockKeyPrefix+"account_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := multi.DelayExpire(ctx, 10); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := multi.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if exists, _ := client.Get(ctx, LockKeyPrefix+"account_2"); exists != "" {
+		t.Error("account_2 is not released")
+	}
+	t.Log("success")
+}
+
+// 未持有锁时不会接管相同 token 的其他锁持有的 key
+func Test_multiLockSameToken(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	single := NewRedisLock("account_1", client, SetExpireSeconds(5), SetOwnerToken("owner"))
+	if err := single.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	multi := NewRedisMultiLock([]string{"account_1", "account_2"}, client, SetExpireSeconds(5), SetOwnerToken("owner"))
+	if err := multi.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := single.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 持有锁期间可以重复加锁
+	for i := 0; i < 2; i++ {
+		if err := multi.TryLock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := multi.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 锁丢失后重新加锁，开始新的持有状态并重新启动看门狗
+func Test_multiLockRelockAfterLost(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	multi := NewRedisMultiLock([]string{"account_1", "account_2"}, client)
+	multi.watchDogStep = 1
+	if err := multi.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lost := multi.Lost()
+	if err := client.Del(ctx, LockKeyPrefix+"account_1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lost:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expect lock lost")
+	}
+	if err := multi.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if multi.Lost() == lost {
+		t.Fatal("expect new lease after relock")
+	}
+	// 新的看门狗持续续期，锁不会丢失
+	select {
+	case <-multi.Lost():
+		t.Fatal("lock lost after relock")
+	case <-time.After(2500 * time.Millisecond):
+	}
+	if err := multi.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
@@ -0,0 +1,46 @@
+package redis_distributed_lock
+
+// 命名空间与锁 key 之间的分隔符
+const namespaceSeparator = ":"
+
+// 锁 key 的前缀，未指定时使用 LockKeyPrefix，便于按前缀配置 redis ACL，例如 ~tenant_a:*
+func SetKeyPrefix(prefix string) LockOption {
+	return func(o *LockOptions) {
+		o.keyPrefix = prefix
+	}
+}
+
+// 锁 key 的命名空间，用于隔离共用同一个 redis 的多个环境、租户，锁 key 为 前缀 + 命名空间 + ":" + key
+func SetNamespace(namespace string) LockOption {
+	return func(o *LockOptions) {
+		o.namespace = namespace
+	}
+}
+
+// 以哈希标签包裹锁 key，例如 {order_1}，锁 key 及其 _FENCE、_QUEUE 等派生 key 会被路由到 redis cluster 的同一个节点
+// RedisMultiLock 的每个 key 会被分别包裹，多个 key 需要位于同一个哈希槽时，应当在 key 中显式指定相同的哈希标签
+func ActiveHashTag() LockOption {
+	return func(o *LockOptions) {
+		o.hashTag = true
+	}
+}
+
+// 锁 key 所在的空间：前缀 + 命名空间
+func (o *LockOptions) keySpace() string {
+	prefix := o.keyPrefix
+	if prefix == "" {
+		prefix = LockKeyPrefix
+	}
+	if o.namespace == "" {
+		return prefix
+	}
+	return prefix + o.namespace + namespaceSeparator
+}
+
+// 锁 key
+func (o *LockOptions) lockKey(key string) string {
+	if o.hashTag {
+		key = "{" + key + "}"
+	}
+	return o.keySpace() + key
+}
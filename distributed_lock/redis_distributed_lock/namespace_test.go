@@ -0,0 +1,114 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// 锁 key 由前缀、命名空间以及哈希标签组成
+func Test_lockKey(t *testing.T) {
+	cases := []struct {
+		opts   []LockOption
+		expect string
+	}{
+		{nil, "REDIS_LOCK_PRE_order_1"},
+		{[]LockOption{SetNamespace("prod")}, "REDIS_LOCK_PRE_prod:order_1"},
+		{[]LockOption{SetKeyPrefix("tenant_a:lock:")}, "tenant_a:lock:order_1"},
+		{[]LockOption{SetKeyPrefix("lock:"), SetNamespace("prod"), ActiveHashTag()}, "lock:prod:{order_1}"},
+	}
+	for _, c := range cases {
+		lock := NewRedisLock("order_1", newMemoryClient(t, nil), c.opts...)
+		if got := lock.getLockKey(); got != c.expect {
+			t.Errorf("got key: %s, expect: %s", got, c.expect)
+		}
+	}
+	t.Log("success")
+}
+
+// 不同命名空间下的同名锁互不影响
+func Test_namespaceIsolation(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	prod := NewRedisLock("order_1", client, SetNamespace("prod"), SetOwnerToken("prod"), SetExpireSeconds(5))
+	staging := NewRedisLock("order_1", client, SetNamespace("staging"), SetOwnerToken("staging"), SetExpireSeconds(5))
+	other := NewRedisLock("order_1", client, SetNamespace("prod"), SetOwnerToken("other"), SetExpireSeconds(5))
+	if err := prod.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := staging.Lock(ctx); err != nil {
+		t.Fatalf("expect locks in different namespaces not to collide, err: %v", err)
+	}
+	if err := other.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := prod.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := staging.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 按照命名空间列出、查看、强制释放锁
+func Test_listLocksByNamespace(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	for _, opts := range [][]LockOption{
+		{SetNamespace("prod")},
+		{SetNamespace("prod"), ActiveHashTag(), ActiveFairMode()},
+		{SetNamespace("staging")},
+	} {
+		key := "order_1"
+		if len(opts) > 1 {
+			key = "order_2"
+		}
+		if err := NewRedisLock(key, client, append(opts, SetExpireSeconds(10))...).Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prod := SetNamespace("prod")
+	infos, err := client.ListLocks(ctx, "*", prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Key != "order_1" || infos[1].Key != "{order_2}" {
+		t.Fatalf("got locks: %+v, expect order_1 and {order_2} in prod", infos)
+	}
+	if _, err := client.Inspect(ctx, "{order_2}", prod); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ForceRelease(ctx, "order_1", prod); err != nil {
+		t.Fatal(err)
+	}
+	// staging 中的同名锁不受影响
+	if _, err := client.Inspect(ctx, "order_1", SetNamespace("staging")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Inspect(ctx, "order_1", prod); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotFound)
+	}
+	t.Log("success")
+}
+
+// 以哈希标签包裹的锁 key 及其派生 key 位于同一个哈希槽，可以在集群中使用公平锁
+func Test_hashTagInCluster(t *testing.T) {
+	cluster := newFakeCluster(t)
+	client := NewClusterClient([]string{cluster.nodes[0].Addr()}, "")
+	ctx := context.Background()
+	lock := NewRedisLock("order_1", client, SetNamespace("prod"), ActiveHashTag(), ActiveFairMode(), SetExpireSeconds(5))
+	if keySlot(lock.getLockKey()) != keySlot(lock.getQueueKey()) {
+		t.Fatal("expect lock key and queue key in the same slot")
+	}
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
@@ -0,0 +1,241 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// 定时 ping 检测订阅连接和服务端的健康状态
+	pubSubHealthCheckPeriod = time.Minute
+	// 每个监听者缓存的消息数，消费过慢时丢弃新的消息
+	pubSubListenerBuffer = 64
+)
+
+// 同一个 Client 的所有订阅者共享的订阅连接，按频道将消息分发给监听者
+// 有监听者时建立连接，最后一个监听者退出时关闭连接，连接异常断开时通知所有监听者退出
+type pubSubHub struct {
+	mu   sync.Mutex
+	conn *pubSubConn
+	// 频道 -> 监听者
+	listeners map[string]map[*pubSubListener]struct{}
+	// 服务端已确认订阅的频道
+	subscribed map[string]bool
+}
+
+// 订阅连接，连接被替换后，旧连接的接收协程不再影响新连接的监听者
+type pubSubConn struct {
+	psc    redis.PubSubConn
+	closed chan struct{}
+}
+
+// 监听者，所有频道均确认订阅后 started 被关闭
+type pubSubListener struct {
+	channels []string
+	pending  map[string]struct{}
+	started  chan struct{}
+	messages chan redis.Message
+	// 连接异常断开时写入错误
+	failed chan error
+}
+
+// 监听 pub/sub 频道，频道订阅成功后调用 onStart，每收到一条消息调用一次 onMessage
+// 同一个 Client 的所有监听共享一条订阅连接，不占用连接池，ctx 终止后取消订阅并返回
+func (c *Client) ListenPubSubChannels(ctx context.Context,
+	onStart func() error,
+	onMessage func(channel string, data []byte) error,
+	channels ...string) error {
+	if len(channels) == 0 {
+		return errors.New("no channel to subscribe")
+	}
+	l, err := c.pubSub.add(ctx, c, channels)
+	if err != nil {
+		return err
+	}
+	defer c.pubSub.remove(l)
+	select {
+	case <-l.started:
+	case err := <-l.failed:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+	if err := onStart(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg := <-l.messages:
+			if err := onMessage(msg.Channel, msg.Data); err != nil {
+				return err
+			}
+		case err := <-l.failed:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// 添加监听者，尚未建立连接时建立连接，只订阅尚无监听者的频道
+func (h *pubSubHub) add(ctx context.Context, c *Client, channels []string) (*pubSubListener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		conn, err := c.getRedisConn(ctx,
+			// 读超时需要大于 ping 的间隔
+			redis.DialReadTimeout(pubSubHealthCheckPeriod+10*time.Second),
+			redis.DialWriteTimeout(10*time.Second))
+		if err != nil {
+			return nil, err
+		}
+		h.conn = &pubSubConn{psc: redis.PubSubConn{Conn: conn}, closed: make(chan struct{})}
+		h.listeners = make(map[string]map[*pubSubListener]struct{})
+		h.subscribed = make(map[string]bool)
+		go h.receive(h.conn)
+		go h.healthCheck(h.conn)
+	}
+	l := &pubSubListener{
+		channels: channels,
+		pending:  make(map[string]struct{}),
+		started:  make(chan struct{}),
+		messages: make(chan redis.Message, pubSubListenerBuffer),
+		failed:   make(chan error, 1),
+	}
+	var subscribe []string
+	for _, channel := range channels {
+		if h.listeners[channel] == nil {
+			h.listeners[channel] = make(map[*pubSubListener]struct{})
+			subscribe = append(subscribe, channel)
+		}
+		h.listeners[channel][l] = struct{}{}
+		if !h.subscribed[channel] {
+			l.pending[channel] = struct{}{}
+		}
+	}
+	if len(l.pending) == 0 {
+		close(l.started)
+	}
+	if len(subscribe) > 0 {
+		if err := h.conn.psc.Subscribe(redis.Args{}.AddFlat(subscribe)...); err != nil {
+			h.closeLocked(err)
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// 移除监听者，取消订阅不再有监听者的频道，没有监听者时关闭连接
+func (h *pubSubHub) remove(l *pubSubListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return
+	}
+	var unsubscribe []string
+	for _, channel := range l.channels {
+		listeners, ok := h.listeners[channel]
+		if !ok {
+			continue
+		}
+		delete(listeners, l)
+		if len(listeners) == 0 {
+			delete(h.listeners, channel)
+			delete(h.subscribed, channel)
+			unsubscribe = append(unsubscribe, channel)
+		}
+	}
+	if len(h.listeners) == 0 {
+		h.closeLocked(nil)
+		return
+	}
+	if len(unsubscribe) > 0 {
+		if err := h.conn.psc.Unsubscribe(redis.Args{}.AddFlat(unsubscribe)...); err != nil {
+			h.closeLocked(err)
+		}
+	}
+}
+
+// 接收服务端推送的消息并分发
+func (h *pubSubHub) receive(conn *pubSubConn) {
+	for {
+		switch n := conn.psc.Receive().(type) {
+		case error:
+			h.mu.Lock()
+			// 连接已经被关闭或者替换
+			if h.conn == conn {
+				h.closeLocked(n)
+			}
+			h.mu.Unlock()
+			return
+		case redis.Message:
+			h.mu.Lock()
+			for l := range h.listeners[n.Channel] {
+				select {
+				case l.messages <- n:
+				default:
+				}
+			}
+			h.mu.Unlock()
+		case redis.Subscription:
+			if n.Kind != "subscribe" {
+				continue
+			}
+			h.mu.Lock()
+			if _, ok := h.listeners[n.Channel]; ok && h.conn == conn {
+				h.subscribed[n.Channel] = true
+				for l := range h.listeners[n.Channel] {
+					if _, ok := l.pending[n.Channel]; !ok {
+						continue
+					}
+					delete(l.pending, n.Channel)
+					if len(l.pending) == 0 {
+						close(l.started)
+					}
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// 定时 ping，没有收到 pong 时接收协程会因为读超时而退出
+func (h *pubSubHub) healthCheck(conn *pubSubConn) {
+	ticker := time.NewTicker(pubSubHealthCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.closed:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			if h.conn == conn {
+				if err := conn.psc.Ping(""); err != nil {
+					h.closeLocked(err)
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// 关闭连接，err 不为 nil 时通知所有监听者连接异常断开，调用方需要持有锁
+func (h *pubSubHub) closeLocked(err error) {
+	if err != nil {
+		for _, listeners := range h.listeners {
+			for l := range listeners {
+				select {
+				case l.failed <- err:
+				default:
+				}
+			}
+		}
+	}
+	close(h.conn.closed)
+	_ = h.conn.psc.Close()
+	h.conn, h.listeners, h.subscribed = nil, nil, nil
+}
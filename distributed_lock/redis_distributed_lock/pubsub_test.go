@@ -0,0 +1,71 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// 同一个 Client 的监听共享一条订阅连接，消息按频道分发，全部监听退出后关闭连接
+func Test_sharedPubSubConn(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	channels := []string{"test_channel_1", "test_channel_1", "test_channel_2"}
+	var wg sync.WaitGroup
+	started := make(chan struct{}, len(channels))
+	received := make(chan string, len(channels))
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel string) {
+			defer wg.Done()
+			err := client.ListenPubSubChannels(ctx, func() error {
+				started <- struct{}{}
+				return nil
+			}, func(channel string, data []byte) error {
+				received <- channel + ":" + string(data)
+				return nil
+			}, channel)
+			if err != nil {
+				t.Error(err)
+			}
+		}(channel)
+	}
+	for range channels {
+		<-started
+	}
+	if count := mr.CurrentConnectionCount(); count != 1 {
+		t.Errorf("got connections: %d, expect: 1", count)
+	}
+	mr.Publish("test_channel_1", "released")
+	got := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			got[msg]++
+		case <-time.After(time.Second):
+			t.Fatal("message is not delivered")
+		}
+	}
+	if got["test_channel_1:released"] != 2 {
+		t.Errorf("got messages: %v, expect 2 messages of test_channel_1", got)
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("got unexpected message: %s", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	wg.Wait()
+	deadline := time.Now().Add(time.Second)
+	for mr.CurrentConnectionCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := mr.CurrentConnectionCount(); count != 0 {
+		t.Errorf("got connections: %d, expect: 0", count)
+	}
+	t.Log("success")
+}
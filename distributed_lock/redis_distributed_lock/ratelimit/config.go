@@ -0,0 +1,24 @@
+package ratelimit
+
+// 默认的限流 key 前缀
+const DefaultKeyPrefix = "REDIS_RATE_LIMIT_"
+
+// 限流配置
+type Options struct {
+	keyPrefix string
+}
+
+type Option func(*Options)
+
+// 限流 key 的前缀，未指定时使用 DefaultKeyPrefix
+func SetKeyPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.keyPrefix = prefix
+	}
+}
+
+func checkOptions(o *Options) {
+	if o.keyPrefix == "" {
+		o.keyPrefix = DefaultKeyPrefix
+	}
+}
@@ -0,0 +1,165 @@
+// Package ratelimit 基于 redis lua 脚本实现分布式限流，检查配额与扣减配额在同一个脚本内原子执行，
+// 支持令牌桶、固定窗口以及滑动日志三种算法，客户端与分布式锁共用 redis_distributed_lock.LockClient
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	rdl "redis_distributed_lock"
+)
+
+// 请求数量超过配额上限，永远无法放行
+var ErrExceedsLimit = errors.New("request exceeds rate limit")
+
+// 单次限流的结果
+type Result struct {
+	// 是否放行
+	Allowed bool
+	// 剩余配额
+	Remaining int64
+	// 未放行时，需要等待多久才可能放行，请求数量超过配额上限时为 -1
+	RetryAfter time.Duration
+	// 多久之后配额完全恢复
+	ResetAfter time.Duration
+}
+
+// 分布式限流器
+type Limiter struct {
+	Options
+	key    string
+	client rdl.LockClient
+	// 限流脚本及其参数，参数之后追加本次请求的数量
+	src  string
+	args []interface{}
+	// 是否需要为每次请求生成 nonce
+	nonce bool
+}
+
+// 令牌桶限流，以每秒 rate 个的速度补充令牌，最多积累 burst 个令牌，允许突发 burst 个请求
+// rate 小于等于 0 时按 1 处理，burst 小于 1 时按 1 处理
+func NewTokenBucketLimiter(key string, client rdl.LockClient, rate float64, burst int64, opts ...Option) *Limiter {
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return newLimiter(key, client, LuaTokenBucket, []interface{}{rate, burst}, false, opts)
+}
+
+// 固定窗口限流，每个窗口内最多放行 limit 个请求，窗口从第一个请求开始计时
+// 实现简单，但在窗口交界处最多可能放行 2 * limit 个请求
+// limit 小于 1 时按 1 处理，window 小于 1 毫秒时按 1 秒处理
+func NewFixedWindowLimiter(key string, client rdl.LockClient, limit int64, window time.Duration, opts ...Option) *Limiter {
+	limit, window = checkWindow(limit, window)
+	return newLimiter(key, client, LuaFixedWindow, []interface{}{limit, window.Milliseconds()}, false, opts)
+}
+
+// 滑动日志限流，任意 window 时长内最多放行 limit 个请求，精确但每个请求都占用一个 zset 成员，适用于 limit 较小的场景
+// limit 小于 1 时按 1 处理，window 小于 1 毫秒时按 1 秒处理
+func NewSlidingLogLimiter(key string, client rdl.LockClient, limit int64, window time.Duration, opts ...Option) *Limiter {
+	limit, window = checkWindow(limit, window)
+	return newLimiter(key, client, LuaSlidingLog, []interface{}{limit, window.Milliseconds()}, true, opts)
+}
+
+func newLimiter(key string, client rdl.LockClient, src string, args []interface{}, nonce bool, opts []Option) *Limiter {
+	l := Limiter{
+		key:    key,
+		client: client,
+		src:    src,
+		args:   args,
+		nonce:  nonce,
+	}
+	for _, opt := range opts {
+		opt(&l.Options)
+	}
+	checkOptions(&l.Options)
+	return &l
+}
+
+func checkWindow(limit int64, window time.Duration) (int64, time.Duration) {
+	if limit < 1 {
+		limit = 1
+	}
+	if window < time.Millisecond {
+		window = time.Second
+	}
+	return limit, window
+}
+
+// 限流 key
+func (l *Limiter) getKey() string {
+	return l.keyPrefix + l.key
+}
+
+// 请求一次
+func (l *Limiter) Allow(ctx context.Context) (*Result, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// 请求 n 次，配额足够时一并放行，否则一次都不放行
+func (l *Limiter) AllowN(ctx context.Context, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid request count: %d", n)
+	}
+	keysAndArgs := append([]interface{}{l.getKey()}, l.args...)
+	keysAndArgs = append(keysAndArgs, n)
+	if l.nonce {
+		keysAndArgs = append(keysAndArgs, rdl.GetRandomNonce())
+	}
+	reply, err := redis.Int64s(l.client.Eval(ctx, l.src, 1, keysAndArgs))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 4 {
+		return nil, fmt.Errorf("invalid rate limit reply: %v", reply)
+	}
+	res := Result{
+		Allowed:    reply[0] == 1,
+		Remaining:  reply[1],
+		RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+		ResetAfter: time.Duration(reply[3]) * time.Millisecond,
+	}
+	if reply[2] < 0 {
+		res.RetryAfter = -1
+	}
+	return &res, nil
+}
+
+// 等待直到放行一次，ctx 终止时返回 ctx 的错误
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// 等待直到一并放行 n 次，n 超过配额上限时返回 ErrExceedsLimit，ctx 终止时返回 ctx 的错误
+func (l *Limiter) WaitN(ctx context.Context, n int64) error {
+	for {
+		res, err := l.AllowN(ctx, n)
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+		if res.RetryAfter < 0 {
+			return fmt.Errorf("request count: %d, err: %w", n, ErrExceedsLimit)
+		}
+		// 至少等待 1 毫秒，避免忙等
+		wait := max(res.RetryAfter, time.Millisecond)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			// 截止时间之前不可能放行，无需等待
+			return fmt.Errorf("rate limit wait %v exceeds ctx deadline, err: %w", wait, context.DeadlineExceeded)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
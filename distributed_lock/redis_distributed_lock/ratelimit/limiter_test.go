@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rdl "redis_distributed_lock"
+	"redis_distributed_lock/redistest"
+)
+
+// 创建内存客户端，测试结束时关闭
+func newMemoryClient(t *testing.T, clock redistest.Clock) *redistest.MemoryClient {
+	t.Helper()
+	client, err := redistest.NewMemoryClient(clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// 检查限流结果
+func expectResult(t *testing.T, res *Result, err error, allowed bool, remaining int64, retryAfter time.Duration) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed != allowed || res.Remaining != remaining || res.RetryAfter != retryAfter {
+		t.Errorf("got result: %+v, expect allowed: %v, remaining: %d, retry after: %v", res, allowed, remaining, retryAfter)
+	}
+}
+
+// 令牌桶允许突发 burst 个请求，之后按照 rate 补充令牌
+func Test_tokenBucket(t *testing.T) {
+	clock := redistest.NewManualClock(time.UnixMilli(1700000000000))
+	client := newMemoryClient(t, clock)
+	l := NewTokenBucketLimiter("test_token_bucket", client, 10, 5)
+	ctx := context.Background()
+	res, err := l.AllowN(ctx, 4)
+	expectResult(t, res, err, true, 1, 0)
+	if res.ResetAfter != 400*time.Millisecond {
+		t.Errorf("got reset after: %v, expect: 400ms", res.ResetAfter)
+	}
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, true, 0, 0)
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, false, 0, 100*time.Millisecond)
+	res, err = l.AllowN(ctx, 6)
+	expectResult(t, res, err, false, 0, -1)
+	clock.Advance(100 * time.Millisecond)
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, true, 0, 0)
+	// 令牌最多积累 burst 个
+	clock.Advance(time.Minute)
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, true, 4, 0)
+	t.Log("success")
+}
+
+// 固定窗口内最多放行 limit 个请求，窗口结束后配额恢复
+func Test_fixedWindow(t *testing.T) {
+	clock := redistest.NewManualClock(time.UnixMilli(1700000000000))
+	client := newMemoryClient(t, clock)
+	l := NewFixedWindowLimiter("test_fixed_window", client, 3, time.Second)
+	ctx := context.Background()
+	res, err := l.AllowN(ctx, 2)
+	expectResult(t, res, err, true, 1, 0)
+	clock.Advance(300 * time.Millisecond)
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, true, 0, 0)
+	if res.ResetAfter != 700*time.Millisecond {
+		t.Errorf("got reset after: %v, expect: 700ms", res.ResetAfter)
+	}
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, false, 0, 700*time.Millisecond)
+	res, err = l.AllowN(ctx, 4)
+	expectResult(t, res, err, false, 0, -1)
+	clock.Advance(700 * time.Millisecond)
+	res, err = l.AllowN(ctx, 3)
+	expectResult(t, res, err, true, 0, 0)
+	t.Log("success")
+}
+
+// 滑动日志在任意 window 时长内最多放行 limit 个请求
+func Test_slidingLog(t *testing.T) {
+	clock := redistest.NewManualClock(time.UnixMilli(1700000000000))
+	client := newMemoryClient(t, clock)
+	l := NewSlidingLogLimiter("test_sliding_log", client, 3, time.Second)
+	ctx := context.Background()
+	res, err := l.AllowN(ctx, 2)
+	expectResult(t, res, err, true, 1, 0)
+	clock.Advance(500 * time.Millisecond)
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, true, 0, 0)
+	clock.Advance(100 * time.Millisecond)
+	// 最早的请求在 400ms 后滑出窗口
+	res, err = l.Allow(ctx)
+	expectResult(t, res, err, false, 0, 400*time.Millisecond)
+	if res.ResetAfter != 900*time.Millisecond {
+		t.Errorf("got reset after: %v, expect: 900ms", res.ResetAfter)
+	}
+	clock.Advance(400 * time.Millisecond)
+	res, err = l.AllowN(ctx, 2)
+	expectResult(t, res, err, true, 0, 0)
+	res, err = l.AllowN(ctx, 4)
+	expectResult(t, res, err, false, 0, -1)
+	t.Log("success")
+}
+
+// 等待直到放行
+func Test_wait(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	l := NewTokenBucketLimiter("test_wait", client, 20, 1)
+	ctx := context.Background()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost < 40*time.Millisecond || cost > 200*time.Millisecond {
+		t.Errorf("waited %v, expect about 50ms", cost)
+	}
+	if err := l.WaitN(ctx, 2); !errors.Is(err, ErrExceedsLimit) {
+		t.Errorf("got err: %v, expect: %v", err, ErrExceedsLimit)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got err: %v, expect: %v", err, context.DeadlineExceeded)
+	}
+	t.Log("success")
+}
+
+// 并发请求时检查与扣减配额是原子的
+func Test_concurrentAllow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := rdl.NewClient("tcp", mr.Addr(), "", rdl.SetMaxIdleLinks(10))
+	ctx := context.Background()
+	for _, l := range []*Limiter{
+		NewTokenBucketLimiter("test_concurrent_token_bucket", client, 0.001, 10),
+		NewFixedWindowLimiter("test_concurrent_fixed_window", client, 10, time.Minute),
+		NewSlidingLogLimiter("test_concurrent_sliding_log", client, 10, time.Minute),
+	} {
+		var allowed int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := l.Allow(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.Allowed {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if allowed != 10 {
+			t.Errorf("limiter %s allowed: %d, expect: 10", l.key, allowed)
+		}
+	}
+	t.Log("success")
+}
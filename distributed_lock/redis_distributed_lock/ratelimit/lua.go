@@ -0,0 +1,94 @@
+package ratelimit
+
+// 所有脚本均以 redis 服务端的时间（毫秒）计时，避免客户端之间的时钟偏差
+// 返回 {是否放行, 剩余配额, 需要等待的时间（毫秒）, 配额完全恢复的时间（毫秒）}
+// 请求数量超过配额上限、永远无法放行时，需要等待的时间为 -1
+
+// 令牌桶，以 rate 个/秒的速度向容量为 burst 的桶中补充令牌，桶中令牌足够时放行并扣除令牌
+// 令牌数以及上次补充的时间记录在 hash 中，桶装满之后 key 自动过期
+const LuaTokenBucket = `
+	local key = KEYS[1]
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local n = tonumber(ARGV[3])
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	local tokens = tonumber(redis.call('hget', key, 'tokens'))
+	local updatedAt = tonumber(redis.call('hget', key, 'updated_at'))
+	if (not tokens or not updatedAt) then
+		tokens = burst
+		updatedAt = nowMillis
+	end
+	tokens = math.min(burst, tokens + math.max(0, nowMillis - updatedAt) * rate / 1000)
+	local allowed = 0
+	local retryAfter = 0
+	if (tokens >= n) then
+		tokens = tokens - n
+		allowed = 1
+	elseif (n > burst) then
+		retryAfter = -1
+	else
+		retryAfter = math.ceil((n - tokens) * 1000 / rate)
+	end
+	local resetAfter = math.ceil((burst - tokens) * 1000 / rate)
+	redis.call('hset', key, 'tokens', tokens, 'updated_at', nowMillis)
+	redis.call('pexpire', key, resetAfter + 1000)
+	return {allowed, math.floor(tokens), retryAfter, resetAfter}
+`
+
+// 固定窗口，窗口内最多放行 limit 个请求，窗口从第一个请求开始计时，窗口结束时计数器过期
+const LuaFixedWindow = `
+	local key = KEYS[1]
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local n = tonumber(ARGV[3])
+	local current = tonumber(redis.call('get', key) or 0)
+	local resetAfter = redis.call('pttl', key)
+	if (resetAfter < 0) then
+		resetAfter = window
+	end
+	if (current + n > limit) then
+		local retryAfter = resetAfter
+		if (n > limit) then
+			retryAfter = -1
+		end
+		return {0, math.max(0, limit - current), retryAfter, resetAfter}
+	end
+	current = redis.call('incrby', key, n)
+	if (redis.call('pttl', key) < 0) then
+		redis.call('pexpire', key, window)
+	end
+	return {1, limit - current, 0, resetAfter}
+`
+
+// 滑动日志，以 zset 记录窗口内每个请求的时间，最近 window 毫秒内的请求数不超过 limit 时放行
+// 请求的成员为 nonce:序号，保证同一毫秒内的多个请求互不覆盖
+const LuaSlidingLog = `
+	local key = KEYS[1]
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local n = tonumber(ARGV[3])
+	local nonce = ARGV[4]
+	local now = redis.call('time')
+	local nowMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+	redis.call('zremrangebyscore', key, '-inf', nowMillis - window)
+	local count = redis.call('zcard', key)
+	if (count + n > limit) then
+		local retryAfter = -1
+		if (n <= limit) then
+			local oldest = redis.call('zrange', key, count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+			retryAfter = tonumber(oldest[2]) + window - nowMillis
+		end
+		local resetAfter = 0
+		if (count > 0) then
+			local newest = redis.call('zrange', key, -1, -1, 'WITHSCORES')
+			resetAfter = tonumber(newest[2]) + window - nowMillis
+		end
+		return {0, math.max(0, limit - count), retryAfter, resetAfter}
+	end
+	for i = 1, n do
+		redis.call('zadd', key, nowMillis, nonce .. ':' .. i)
+	end
+	redis.call('pexpire', key, window)
+	return {1, limit - count - n, 0, window}
+`
@@ -13,9 +13,19 @@ type LockClient interface {
 	Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error)
 }
 
+// 支持 pub/sub 的客户端，阻塞等锁时用于接收锁释放通知，未实现时退化为轮询取锁
+type PubSubClient interface {
+	ListenPubSubChannels(ctx context.Context, onStart func() error,
+		onMessage func(channel string, data []byte) error, channels ...string) error
+}
+
 type Client struct {
 	ClientOptions
 	pool *redis.Pool
+	// 通过哨兵发现主节点，为 nil 时直接连接 address
+	sentinel *sentinel
+	// 所有订阅者共享的订阅连接
+	pubSub pubSubHub
 }
 
 // 创建一个redis客户端
@@ -31,10 +41,15 @@ func NewClient(network, address, password string, opts ...ClientOption) *Client
 		opt(&c.ClientOptions)
 	}
 	checkClientOptions(&c.ClientOptions)
-	pool := c.getRedisPool()
-	return &Client{
-		pool: pool,
-	}
+	c.pool = c.getRedisPool()
+	c.metrics.watchClient(&c)
+	return &c
+}
+
+// 关闭连接池，不再统计连接池指标
+func (c *Client) Close() error {
+	c.metrics.unwatchClient(c)
+	return c.pool.Close()
 }
 
 // 获得redis连接池
@@ -42,8 +57,8 @@ func (c *Client) getRedisPool() *redis.Pool {
 	return &redis.Pool{
 		MaxIdle:     c.maxIdleLinks,
 		IdleTimeout: time.Duration(c.linkTimeoutSeconds) * time.Second,
-		Dial: func() (redis.Conn, error) {
-			c, err := c.getRedisConn()
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			c, err := c.getRedisConn(ctx)
 			if err != nil {
 				return nil, err
 			}
@@ -51,27 +66,44 @@ func (c *Client) getRedisPool() *redis.Pool {
 		},
 		MaxActive: c.maxActiveLinks,
 		Wait:      c.wait,
-		TestOnBorrow: func(c redis.Conn, lastUsed time.Time) error {
-			_, err := c.Do("PING")
+		TestOnBorrow: func(conn redis.Conn, lastUsed time.Time) error {
+			// 哨兵模式下，主从切换后原主节点的连接不再可用
+			if c.sentinel != nil {
+				return checkMasterRole(context.Background(), conn)
+			}
+			_, err := conn.Do("PING")
 			return err
 		},
 	}
 }
 
 // 获取redis连接
-func (c *Client) getRedisConn() (redis.Conn, error) {
-	if c.address == "" {
+func (c *Client) getRedisConn(ctx context.Context, dialOpts ...redis.DialOption) (redis.Conn, error) {
+	address := c.address
+	if c.sentinel != nil {
+		var err error
+		if address, err = c.sentinel.masterAddr(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if address == "" {
 		panic("Cannot get redis address from config")
 	}
-	var dialOpts []redis.DialOption
 	if len(c.password) > 0 {
 		dialOpts = append(dialOpts, redis.DialPassword(c.password))
 	}
-	conn, err := redis.DialContext(context.Background(),
-		c.network, c.address, dialOpts...)
+	conn, err := redis.DialContext(ctx,
+		c.network, address, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
+	// 哨兵返回的主节点可能尚未完成切换
+	if c.sentinel != nil {
+		if err := checkMasterRole(ctx, conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 	return conn, nil
 }
 
@@ -85,7 +117,7 @@ func (c *Client) Get(ctx context.Context, key string) (string, error) {
 		return "", err
 	}
 	defer conn.Close()
-	return redis.String(conn.Do("GET", key))
+	return redis.String(redis.DoContext(conn, ctx, "GET", key))
 }
 
 // set key
@@ -98,7 +130,7 @@ func (c *Client) Set(ctx context.Context, key, value string) (int64, error) {
 		return -1, err
 	}
 	defer conn.Close()
-	reply, err := conn.Do("SET", key, value)
+	reply, err := redis.DoContext(conn, ctx, "SET", key, value)
 	if err != nil {
 		return -1, err
 	}
@@ -118,13 +150,17 @@ func (c *Client) SetNX(ctx context.Context, key, value string) (int64, error) {
 		return -1, err
 	}
 	defer conn.Close()
-	reply, err := conn.Do("SET", key, value, "NX")
+	reply, err := redis.DoContext(conn, ctx, "SET", key, value, "NX")
 	if err != nil {
 		return -1, err
 	}
 	if resp, ok := reply.(string); ok && strings.ToLower(resp) == "ok" {
 		return 1, nil
 	}
+	// key 已存在时 NX 返回 nil
+	if reply == nil {
+		return 0, nil
+	}
 	return redis.Int64(reply, err)
 }
 
@@ -138,13 +174,17 @@ func (c *Client) SetNEX(ctx context.Context, key, value string, expiredSeconds i
 		return -1, err
 	}
 	defer conn.Close()
-	reply, err := conn.Do("SET", key, value, "EX", expiredSeconds, "NX")
+	reply, err := redis.DoContext(conn, ctx, "SET", key, value, "EX", expiredSeconds, "NX")
 	if err != nil {
 		return -1, err
 	}
 	if resp, ok := reply.(string); ok && strings.ToLower(resp) == "ok" {
 		return 1, nil
 	}
+	// key 已存在时 NX 返回 nil
+	if reply == nil {
+		return 0, nil
+	}
 	return redis.Int64(reply, err)
 }
 
@@ -158,7 +198,7 @@ func (c *Client) Del(ctx context.Context, key string) error {
 		return err
 	}
 	defer conn.Close()
-	_, err = conn.Do("DEL", key)
+	_, err = redis.DoContext(conn, ctx, "DEL", key)
 	return err
 }
 
@@ -172,19 +212,32 @@ func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
 		return -1, err
 	}
 	defer conn.Close()
-	return redis.Int64(conn.Do("INCR", key))
+	return redis.Int64(redis.DoContext(conn, ctx, "INCR", key))
 }
 
-// lua script
+// lua script，通过 EVALSHA 执行，服务端未缓存脚本时回退到 EVAL
 func (c *Client) Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error) {
-	args := make([]interface{}, 2+len(keysAndArgs))
-	args[0] = src
-	args[1] = keyCount
-	copy(args[2:], keysAndArgs)
 	conn, err := c.pool.GetContext(ctx)
 	if err != nil {
 		return -1, err
 	}
 	defer conn.Close()
-	return conn.Do("EVAL", args...)
+	return evalSha(src, keyCount, keysAndArgs, func(cmd string, args ...interface{}) (interface{}, error) {
+		return redis.DoContext(conn, ctx, cmd, args...)
+	})
+}
+
+// 通过 SCRIPT LOAD 预先缓存 lua 脚本，避免首次执行时传输脚本
+func (c *Client) LoadScripts(ctx context.Context, srcs ...string) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, src := range srcs {
+		if _, err := redis.DoContext(conn, ctx, "SCRIPT", "LOAD", src); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,210 @@
+// redistest 提供基于 miniredis 的内存版 redis 客户端，用于不依赖 redis 服务的测试
+// 不依赖 redis_distributed_lock，因此包内测试以及其他包的测试都可以引用
+package redistest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+// 连接池最大空闲连接数
+const maxIdleLinks = 10
+
+// 时钟，内存客户端基于时钟判断 key 是否过期
+type Clock interface {
+	Now() time.Time
+}
+
+// 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// 手动时钟，只有调用 Advance 时才会前进，用于在测试中控制 key 的过期
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// 时钟前进 d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// 内存版 LockClient，在进程内启动 miniredis 并通过连接池访问
+// miniredis 中 key 的过期时间只在快进时流逝，因此每次执行命令前将 miniredis 的时间同步到时钟，
+// 并快进上次同步以来经过的时长，TIME 命令同样返回时钟的时间
+type MemoryClient struct {
+	pool   *redis.Pool
+	server *miniredis.Miniredis
+	clock  Clock
+	mu     sync.Mutex
+	// 上次同步的时间
+	synced time.Time
+}
+
+// 创建内存客户端，clock 为 nil 时使用系统时钟
+func NewMemoryClient(clock Clock) (*MemoryClient, error) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	server := miniredis.NewMiniRedis()
+	if err := server.Start(); err != nil {
+		return nil, fmt.Errorf("can not start miniredis, err: %w", err)
+	}
+	now := clock.Now()
+	server.SetTime(now)
+	return &MemoryClient{
+		pool: &redis.Pool{
+			MaxIdle: maxIdleLinks,
+			DialContext: func(ctx context.Context) (redis.Conn, error) {
+				return redis.DialContext(ctx, "tcp", server.Addr())
+			},
+		},
+		server: server,
+		clock:  clock,
+		synced: now,
+	}, nil
+}
+
+// get key
+func (c *MemoryClient) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(c.do(ctx, "GET", key))
+}
+
+// set nex
+func (c *MemoryClient) SetNEX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	reply, err := c.do(ctx, "SET", key, value, "EX", expireSeconds, "NX")
+	if err != nil {
+		return -1, err
+	}
+	if resp, ok := reply.(string); ok && strings.ToLower(resp) == "ok" {
+		return 1, nil
+	}
+	// key 已存在时 NX 返回 nil
+	if reply == nil {
+		return 0, nil
+	}
+	return redis.Int64(reply, err)
+}
+
+// del key
+func (c *MemoryClient) Del(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", key)
+	return err
+}
+
+// lua script
+func (c *MemoryClient) Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error) {
+	return c.do(ctx, "EVAL", redis.Args{src, keyCount}.Add(keysAndArgs...)...)
+}
+
+// 监听 pub/sub 频道，频道订阅成功后调用 onStart，每收到一条消息调用一次 onMessage
+// 每次监听独占一条连接，ctx 终止后取消订阅并返回
+func (c *MemoryClient) ListenPubSubChannels(ctx context.Context,
+	onStart func() error,
+	onMessage func(channel string, data []byte) error,
+	channels ...string) error {
+	if len(channels) == 0 {
+		return errors.New("no channel to subscribe")
+	}
+	conn, err := redis.DialContext(ctx, "tcp", c.server.Addr())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(redis.Args{}.AddFlat(channels)...); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	// 启动协程接收服务端推送的消息
+	go func() {
+		for {
+			switch n := psc.Receive().(type) {
+			case error:
+				done <- n
+				return
+			case redis.Message:
+				if err := onMessage(n.Channel, n.Data); err != nil {
+					done <- err
+					return
+				}
+			case redis.Subscription:
+				switch n.Count {
+				case len(channels):
+					// 所有频道订阅成功
+					if err := onStart(); err != nil {
+						done <- err
+						return
+					}
+				case 0:
+					// 所有频道取消订阅后退出
+					done <- nil
+					return
+				}
+			}
+		}
+	}()
+	select {
+	case <-ctx.Done():
+	case err := <-done:
+		return err
+	}
+	// 取消订阅所有频道，通知接收协程退出
+	if err := psc.Unsubscribe(); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// 关闭连接池以及 miniredis
+func (c *MemoryClient) Close() error {
+	err := c.pool.Close()
+	c.server.Close()
+	return err
+}
+
+// 同步时钟后执行命令
+func (c *MemoryClient) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	c.sync()
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+// 将 miniredis 的时间同步到时钟，快进经过的时长使 key 按照时钟过期
+func (c *MemoryClient) sync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if elapsed := now.Sub(c.synced); elapsed > 0 {
+		c.server.SetTime(now)
+		c.server.FastForward(elapsed)
+		c.synced = now
+	}
+}
@@ -0,0 +1,71 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 内存客户端按照时钟判断 key 是否过期
+func Test_memoryClientExpire(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	client, err := NewMemoryClient(clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	if reply, err := client.SetNEX(ctx, "test_memory_key", "v1", 2); err != nil || reply != 1 {
+		t.Fatalf("got reply: %d, err: %v, expect: 1", reply, err)
+	}
+	if reply, err := client.SetNEX(ctx, "test_memory_key", "v2", 2); err != nil || reply != 0 {
+		t.Fatalf("got reply: %d, err: %v, expect: 0", reply, err)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := client.Get(ctx, "test_memory_key"); !errors.Is(err, redis.ErrNil) {
+		t.Errorf("got err: %v, expect: %v", err, redis.ErrNil)
+	}
+	// lua 脚本中的 TIME 同样按照时钟返回
+	reply, err := redis.Int64s(client.Eval(ctx, `return redis.call('time')`, 0, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now := clock.Now(); reply[0] != now.Unix() {
+		t.Errorf("got time: %d, expect: %d", reply[0], now.Unix())
+	}
+	t.Log("success")
+}
+
+// 内存客户端执行 lua 脚本，回复类型与 redigo 保持一致
+func Test_memoryClientEval(t *testing.T) {
+	client, err := NewMemoryClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	reply, err := client.Eval(ctx, `
+redis.call('hset', KEYS[1], ARGV[1], ARGV[2])
+return {redis.call('hget', KEYS[1], ARGV[1]), redis.call('hlen', KEYS[1])}
+`, 1, []interface{}{"test_memory_hash", "field", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := redis.String(values[0], nil); value != "1" || values[1] != int64(1) {
+		t.Errorf("got reply: %v, expect: [1 1]", values)
+	}
+	// 命令执行出错时中断脚本
+	_, err = client.Eval(ctx, `redis.call('incr', KEYS[1]); return 1`, 1, []interface{}{"test_memory_hash"})
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		t.Errorf("got err: %v, expect WRONGTYPE error", err)
+	}
+	t.Log("success")
+}
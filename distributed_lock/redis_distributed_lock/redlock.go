@@ -0,0 +1,113 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 红锁最少需要的节点数
+const minRedLockNodes = 3
+
+// 红锁，基于多个相互独立的 redis 节点实现
+type RedLock struct {
+	RedLockOptions
+	locks []*RedisLock
+	// 加锁成功后锁的有效截止时间
+	validUntil time.Time
+}
+
+// 初始化
+func NewRedLock(key string, confs []*SingleNodeConf, opts ...RedLockOption) (*RedLock, error) {
+	clients := make([]LockClient, 0, len(confs))
+	for _, conf := range confs {
+		clients = append(clients, NewClient(conf.Network, conf.Address, conf.Password, conf.Opts...))
+	}
+	return newRedLock(key, clients, opts...)
+}
+
+// 基于已有的客户端初始化，测试中可以传入内存客户端
+func newRedLock(key string, clients []LockClient, opts ...RedLockOption) (*RedLock, error) {
+	// 3 个及以上节点，红锁才有意义
+	if len(clients) < minRedLockNodes {
+		return nil, fmt.Errorf("can not use redLock with less than %d nodes", minRedLockNodes)
+	}
+	r := RedLock{}
+	for _, opt := range opts {
+		opt(&r.RedLockOptions)
+	}
+	checkRedLockOption(&r.RedLockOptions)
+	// 所有节点累计的加锁超时时间需要小于锁过期时间的十分之一，否则加锁完成时锁的有效期所剩无几
+	if time.Duration(len(clients))*r.singleNodesTimeout*10 > r.expireDuration {
+		return nil, errors.New("expire thresholds of single node is too long")
+	}
+	// 单节点锁以秒为单位过期，向上取整保证节点上的锁不早于红锁的有效期失效
+	expireSeconds := int64(math.Ceil(r.expireDuration.Seconds()))
+	r.locks = make([]*RedisLock, 0, len(clients))
+	for _, client := range clients {
+		r.locks = append(r.locks, NewRedisLock(key, client, SetExpireSeconds(expireSeconds)))
+	}
+	return &r, nil
+}
+
+// 加锁，需要在半数以上的节点加锁成功，且扣除耗时后锁仍在有效期内
+func (r *RedLock) Lock(ctx context.Context) error {
+	start := time.Now()
+	var successCnt int
+	for _, lock := range r.locks {
+		// 单个节点的加锁耗时不能超过节点超时时间，避免在故障节点上阻塞过久
+		nodeCtx, cancel := context.WithTimeout(ctx, r.singleNodesTimeout)
+		err := lock.Lock(nodeCtx)
+		cancel()
+		if err == nil {
+			successCnt++
+		}
+	}
+	// 扣除加锁耗时以及各节点间的时钟漂移，得到锁的剩余有效期
+	drift := r.expireDuration/100 + 2*time.Millisecond
+	validity := r.expireDuration - time.Since(start) - drift
+	if successCnt >= r.quorum() && validity > 0 {
+		r.validUntil = time.Now().Add(validity)
+		return nil
+	}
+	// 加锁失败，需要释放所有节点上的锁，包括超时但可能已经写入成功的节点
+	// 加锁失败时 ctx 往往已经终止，使用独立的 ctx 并限制超时时间，保证能够回滚
+	unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(len(r.locks))*r.singleNodesTimeout)
+	defer cancel()
+	_ = r.Unlock(unlockCtx)
+	return fmt.Errorf("lock failed, success nodes: %d, validity: %v, err: %w", successCnt, validity, ErrLockAcquiredByOthers)
+}
+
+// 锁的剩余有效期，未持有锁时返回 0
+func (r *RedLock) Validity() time.Duration {
+	validity := time.Until(r.validUntil)
+	if validity < 0 {
+		return 0
+	}
+	return validity
+}
+
+// 解锁，对所有节点广播解锁，半数以上节点解锁成功即视为成功
+func (r *RedLock) Unlock(ctx context.Context) error {
+	r.validUntil = time.Time{}
+	var successCnt int
+	var errs []error
+	for _, lock := range r.locks {
+		if err := lock.Unlock(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		successCnt++
+	}
+	if successCnt >= r.quorum() {
+		return nil
+	}
+	return fmt.Errorf("unlock failed, success nodes: %d, err: %w", successCnt, errors.Join(errs...))
+}
+
+// 多数派节点数
+func (r *RedLock) quorum() int {
+	return len(r.locks)/2 + 1
+}
@@ -0,0 +1,111 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 红锁测试
+func Test_redLock(t *testing.T) {
+	clients := []LockClient{newMemoryClient(t, nil), newMemoryClient(t, nil), newMemoryClient(t, nil)}
+	redLock1, err := newRedLock("test_red_key", clients, SetExpireDuration(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redLock2, err := newRedLock("test_red_key", clients, SetExpireDuration(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := redLock1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if validity := redLock1.Validity(); validity <= 0 || validity > 2*time.Second {
+		t.Errorf("got validity: %v, expect in (0, 2s]", validity)
+	}
+	if err := redLock2.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := redLock1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := redLock2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := redLock2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 红锁节点数校验
+func Test_redLockNodes(t *testing.T) {
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: "127.0.0.1:6379"},
+		{Network: "tcp", Address: "127.0.0.1:6380"},
+	}
+	if _, err := NewRedLock("test_red_key", confs); err == nil {
+		t.Error("expect err when nodes less than 3")
+	}
+}
+
+// 少数节点不可用时，红锁仍然可以加锁
+func Test_redLockMinorityFailed(t *testing.T) {
+	clients := []LockClient{newMemoryClient(t, nil), newMemoryClient(t, nil), newMemoryClient(t, nil)}
+	// 少数节点上的锁已经被其他人持有
+	other := NewRedisLock("test_red_minority_key", clients[0], SetExpireSeconds(5))
+	ctx := context.Background()
+	if err := other.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	redLock, err := newRedLock("test_red_minority_key", clients, SetExpireDuration(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redLock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := redLock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 加锁过程中 ctx 终止导致加锁失败时，回滚已经加锁成功的节点
+func Test_redLockRollbackOnCtxDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node := newMemoryClient(t, nil)
+	clients := []LockClient{&cancelingClient{LockClient: node, cancel: cancel}, newMemoryClient(t, nil), newMemoryClient(t, nil)}
+	redLock, err := newRedLock("test_red_rollback_key", clients, SetExpireDuration(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redLock.Lock(ctx); err == nil {
+		t.Fatal("expect err when ctx canceled")
+	}
+	if _, err := node.Get(context.Background(), redLock.locks[0].getLockKey()); !errors.Is(err, redis.ErrNil) {
+		t.Errorf("got err: %v, expect lock on node released", err)
+	}
+	t.Log("success")
+}
+
+// 第一次请求完成后终止 ctx 的客户端
+type cancelingClient struct {
+	LockClient
+	cancel func()
+}
+
+func (c *cancelingClient) SetNEX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	defer c.cancel()
+	return c.LockClient.SetNEX(ctx, key, value, expireSeconds)
+}
+
+func (c *cancelingClient) Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error) {
+	defer c.cancel()
+	return c.LockClient.Eval(ctx, src, keyCount, keysAndArgs)
+}
@@ -0,0 +1,82 @@
+package redis_distributed_lock
+
+import (
+	"math/rand"
+	"time"
+)
+
+// 重试策略，阻塞模式下决定每次取锁失败后，等待多久再次取锁
+type RetryStrategy interface {
+	// 第 attempt 次取锁失败后（从 1 开始计数）的等待时间，返回 false 时不再重试
+	Next(attempt int) (time.Duration, bool)
+}
+
+// 固定间隔重试
+type fixedIntervalRetry struct {
+	interval time.Duration
+}
+
+// interval 小于 MinRetryInterval 时使用 MinRetryInterval
+func FixedIntervalRetry(interval time.Duration) RetryStrategy {
+	if interval < MinRetryInterval {
+		interval = MinRetryInterval
+	}
+	return &fixedIntervalRetry{interval: interval}
+}
+
+func (f *fixedIntervalRetry) Next(attempt int) (time.Duration, bool) {
+	return f.interval, true
+}
+
+// 指数退避重试，等待时间从 base 开始逐次翻倍，不超过 max
+// 实际等待时间在 [d/2, d] 之间随机，避免大量等锁者在同一时刻取锁
+type exponentialBackoffRetry struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// base 小于 MinRetryInterval 时使用 MinRetryInterval
+func ExponentialBackoffRetry(base, max time.Duration) RetryStrategy {
+	if base < MinRetryInterval {
+		base = MinRetryInterval
+	}
+	if max < base {
+		max = base
+	}
+	return &exponentialBackoffRetry{base: base, max: max}
+}
+
+func (e *exponentialBackoffRetry) Next(attempt int) (time.Duration, bool) {
+	d := e.base
+	for i := 1; i < attempt && d < e.max; i++ {
+		d *= 2
+	}
+	if d > e.max {
+		d = e.max
+	}
+	if half := int64(d / 2); half > 0 {
+		d = time.Duration(half + rand.Int63n(half+1))
+	}
+	return d, true
+}
+
+// 限制重试次数，最多取锁 maxAttempts 次，每次的等待时间由 strategy 决定
+type limitedAttemptsRetry struct {
+	strategy    RetryStrategy
+	maxAttempts int
+}
+
+// maxAttempts 小于 1 时只取锁一次，不再重试
+func LimitedAttemptsRetry(strategy RetryStrategy, maxAttempts int) RetryStrategy {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &limitedAttemptsRetry{strategy: strategy, maxAttempts: maxAttempts}
+}
+
+func (l *limitedAttemptsRetry) Next(attempt int) (time.Duration, bool) {
+	if attempt >= l.maxAttempts {
+		return 0, false
+	}
+	return l.strategy.Next(attempt)
+}
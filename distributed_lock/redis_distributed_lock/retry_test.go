@@ -0,0 +1,104 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 指数退避的等待时间逐次翻倍，并在 [d/2, d] 之间随机
+func Test_exponentialBackoffRetry(t *testing.T) {
+	strategy := ExponentialBackoffRetry(100*time.Millisecond, time.Second)
+	for attempt, expect := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond, 5: time.Second, 10: time.Second} {
+		wait, ok := strategy.Next(attempt)
+		if !ok || wait < expect/2 || wait > expect {
+			t.Errorf("attempt: %d, got wait: %v, expect in [%v, %v]", attempt, wait, expect/2, expect)
+		}
+	}
+	t.Log("success")
+}
+
+// 间隔、次数不合法时修正为最小值，避免无间隔地轮询 redis
+func Test_retryStrategyBounds(t *testing.T) {
+	for _, strategy := range []RetryStrategy{FixedIntervalRetry(0), FixedIntervalRetry(-time.Second),
+		ExponentialBackoffRetry(0, 0), ExponentialBackoffRetry(-time.Second, time.Second)} {
+		// 指数退避的等待时间在 [d/2, d] 之间随机
+		if wait, ok := strategy.Next(1); !ok || wait < MinRetryInterval/2 {
+			t.Errorf("got wait: %v, expect at least: %v", wait, MinRetryInterval/2)
+		}
+	}
+	for _, maxAttempts := range []int{0, -1} {
+		if _, ok := LimitedAttemptsRetry(FixedIntervalRetry(0), maxAttempts).Next(1); ok {
+			t.Errorf("max attempts: %d, expect no retry", maxAttempts)
+		}
+	}
+	t.Log("success")
+}
+
+// 限制取锁次数
+func Test_limitedAttemptsRetry(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_retry_key", client, SetExpireSeconds(5))
+	var attempts int32
+	strategy := LimitedAttemptsRetry(FixedIntervalRetry(10*time.Millisecond), 3)
+	waiter := NewRedisLock("test_retry_key", client, SetExpireSeconds(5), ActiveBlockMode(),
+		SetRetryStrategy(countingRetry{strategy, &attempts}))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("got attempts: %d, expect: 3", got)
+	}
+	t.Log("success")
+}
+
+// 毫秒精度的等锁时间上限
+func Test_blockWaitingMillis(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_wait_millis_key", client, SetExpireSeconds(5))
+	waiter := NewRedisLock("test_wait_millis_key", client, SetExpireSeconds(5), ActiveBlockMode(),
+		SetBlockWaitingMillis(200), SetRetryStrategy(ExponentialBackoffRetry(10*time.Millisecond, 50*time.Millisecond)))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := waiter.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if cost := time.Since(start); cost < 200*time.Millisecond || cost >= time.Second {
+		t.Errorf("got cost: %v, expect about 200ms", cost)
+	}
+	// 锁释放后按照重试策略取锁
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := holder.Unlock(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := waiter.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 记录取锁次数的重试策略，首次取锁不经过重试策略
+type countingRetry struct {
+	RetryStrategy
+	attempts *int32
+}
+
+func (c countingRetry) Next(attempt int) (time.Duration, bool) {
+	atomic.StoreInt32(c.attempts, int32(attempt))
+	return c.RetryStrategy.Next(attempt)
+}
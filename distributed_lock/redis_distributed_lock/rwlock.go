@@ -0,0 +1,213 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 等待中的写锁登记的有效时长（毫秒），等锁方放弃或者宕机后，登记会在该时长后失效
+const rwLockWriterWaitingMillis = 1000
+
+// redis分布式读写锁，写锁优先
+type RedisRWLock struct {
+	LockOptions
+	key    string
+	client LockClient
+	// 读锁、写锁各自的看门狗
+	rDog watchDog
+	wDog watchDog
+	// 是否已经持有读锁，重复加读锁只续期，不会重复启动看门狗
+	rHeld bool
+	// 读锁、写锁各自的加锁时间，用于统计持有时间
+	rLockedAt time.Time
+	wLockedAt time.Time
+}
+
+// 初始化
+func NewRedisRWLock(key string, client LockClient, opts ...LockOption) *RedisRWLock {
+	r := RedisRWLock{
+		key:    key,
+		client: client,
+	}
+	for _, opt := range opts {
+		opt(&r.LockOptions)
+	}
+	checkLockOptions(&r.LockOptions)
+	return &r
+}
+
+// 写锁 key，与 RedisLock 使用相同的 key
+func (r *RedisRWLock) getLockKey() string {
+	return r.lockKey(r.key)
+}
+
+// 读锁持有者 key
+func (r *RedisRWLock) getReadersKey() string {
+	return r.getLockKey() + "_READERS"
+}
+
+// 锁释放通知频道，与 RedisLock 使用相同的频道
+func (r *RedisRWLock) getChannel() string {
+	return r.getLockKey() + "_CHANNEL"
+}
+
+// 等待中的写锁 key
+func (r *RedisRWLock) getWritersKey() string {
+	return r.getLockKey() + "_WRITERS"
+}
+
+// 加读锁
+func (r *RedisRWLock) RLock(ctx context.Context) (err error) {
+	spanCtx, span := r.tracer.Start(ctx, "RedisRWLock.RLock", trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrBlockMode.Bool(r.blockMode)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = acquire(spanCtx, "RedisRWLock.blockingLock", &r.LockOptions, r.client, []string{r.getChannel()},
+		r.metrics.countAttempts(r.tryRLock))
+	r.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+	if r.rHeld {
+		return nil
+	}
+	r.rHeld = true
+	r.rLockedAt = time.Now()
+	if r.watchDogMode {
+		r.rDog.start(ctx, r.watchDogStep, r.metrics.countRenewals(r.delayRExpire), nil)
+	}
+	return nil
+}
+
+// 尝试获取读锁
+func (r *RedisRWLock) tryRLock(ctx context.Context) error {
+	keysAndArgs := []interface{}{r.getLockKey(), r.getReadersKey(), r.getWritersKey(), r.token, r.expireSeconds}
+	reply, err := r.client.Eval(ctx, LuaRWLockRLock, 3, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("reply: %d, err: %w", ret, ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 更新读锁的过期时间
+func (r *RedisRWLock) delayRExpire(ctx context.Context, expireSeconds int64) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisRWLock.delayRExpire", trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrExpireSeconds.Int64(expireSeconds)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeRenewed, err), err) }()
+	keysAndArgs := []interface{}{r.getReadersKey(), r.token, expireSeconds}
+	reply, err := r.client.Eval(ctx, LuaCheckAndExpiredLease, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not expire read lock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 释放读锁
+func (r *RedisRWLock) RUnlock(ctx context.Context) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisRWLock.RUnlock", trace.WithAttributes(attrLockKey.String(r.getLockKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeReleased, err), err) }()
+	// 停止看门狗
+	defer func() {
+		r.rHeld = false
+		r.rDog.stop()
+		r.metrics.releasedSince(&r.rLockedAt)
+	}()
+	keysAndArgs := []interface{}{r.getReadersKey(), r.token, r.getChannel()}
+	reply, err := r.client.Eval(ctx, LuaRWLockRUnlock, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not unlock read lock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 加写锁
+func (r *RedisRWLock) Lock(ctx context.Context) (err error) {
+	spanCtx, span := r.tracer.Start(ctx, "RedisRWLock.Lock", trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrBlockMode.Bool(r.blockMode)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = acquire(spanCtx, "RedisRWLock.blockingLock", &r.LockOptions, r.client, []string{r.getChannel()},
+		r.metrics.countAttempts(r.tryLock))
+	r.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		// 放弃等锁时，撤销写锁的等待登记，尽早放行读锁
+		// ctx 可能已经终止，使用独立的 ctx 保证能够撤销登记
+		if r.blockMode {
+			keysAndArgs := []interface{}{r.getWritersKey(), r.token, r.getChannel()}
+			_, _ = r.client.Eval(context.WithoutCancel(spanCtx), LuaRWLockCancelWaiting, 1, keysAndArgs)
+		}
+		return err
+	}
+	if r.wLockedAt.IsZero() {
+		r.wLockedAt = time.Now()
+	}
+	if r.watchDogMode {
+		r.wDog.start(ctx, r.watchDogStep, r.metrics.countRenewals(r.delayExpire), nil)
+	}
+	return nil
+}
+
+// 尝试获取写锁，阻塞模式下加锁失败会登记为等待中的写锁
+func (r *RedisRWLock) tryLock(ctx context.Context) error {
+	var waitingMillis int64
+	if r.blockMode {
+		waitingMillis = rwLockWriterWaitingMillis
+	}
+	keysAndArgs := []interface{}{r.getLockKey(), r.getReadersKey(), r.getWritersKey(), r.token, r.expireSeconds, waitingMillis}
+	reply, err := r.client.Eval(ctx, LuaRWLockLock, 3, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("reply: %d, err: %w", ret, ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 更新写锁的过期时间
+func (r *RedisRWLock) delayExpire(ctx context.Context, expireSeconds int64) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisRWLock.delayExpire", trace.WithAttributes(
+		attrLockKey.String(r.getLockKey()), attrExpireSeconds.Int64(expireSeconds)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeRenewed, err), err) }()
+	keysAndArgs := []interface{}{r.getLockKey(), r.token, expireSeconds}
+	reply, err := r.client.Eval(ctx, LuaCheckAndExpiredDistributedLock, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not expire lock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 释放写锁
+func (r *RedisRWLock) Unlock(ctx context.Context) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisRWLock.Unlock", trace.WithAttributes(attrLockKey.String(r.getLockKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeReleased, err), err) }()
+	// 停止看门狗
+	defer func() {
+		r.wDog.stop()
+		r.metrics.releasedSince(&r.wLockedAt)
+	}()
+	keysAndArgs := []interface{}{r.getLockKey(), r.token, r.getChannel()}
+	reply, err := r.client.Eval(ctx, LuaCheckAndDeleteDistributedLock, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not unlock, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
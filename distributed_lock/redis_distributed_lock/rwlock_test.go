@@ -0,0 +1,113 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 读锁之间共享，读写互斥
+func Test_rwLock(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	reader1 := NewRedisRWLock("test_rw_key", client, SetExpireSeconds(5))
+	reader2 := NewRedisRWLock("test_rw_key", client, SetExpireSeconds(5))
+	writer := NewRedisRWLock("test_rw_key", client, SetExpireSeconds(5))
+	ctx := context.Background()
+	if err := reader1.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader2.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Lock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := reader1.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader2.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader1.RLock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := writer.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 写锁优先，等待中的写锁会阻止新的读锁
+func Test_rwLockWriterPreferring(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	reader1 := NewRedisRWLock("test_rw_prefer_key", client, SetExpireSeconds(5))
+	reader2 := NewRedisRWLock("test_rw_prefer_key", client, SetExpireSeconds(5))
+	writer := NewRedisRWLock("test_rw_prefer_key", client, SetExpireSeconds(5), ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := reader1.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	writerLocked := make(chan error, 1)
+	go func() {
+		writerLocked <- writer.Lock(ctx)
+	}()
+	// 等待写锁完成等待登记
+	time.Sleep(200 * time.Millisecond)
+	if err := reader2.RLock(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := reader1.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-writerLocked; err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader2.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader2.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 看门狗模式下重复加读锁只续期，不会重复启动看门狗
+func Test_rwLockRLockTwice(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	reader := NewRedisRWLock("test_rw_twice_key", client)
+	ctx := context.Background()
+	locked := make(chan error, 1)
+	go func() {
+		if err := reader.RLock(ctx); err != nil {
+			locked <- err
+			return
+		}
+		locked <- reader.RLock(ctx)
+	}()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second RLock blocked")
+	}
+	if err := reader.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 解锁后可以再次加读锁并启动看门狗
+	if err := reader.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
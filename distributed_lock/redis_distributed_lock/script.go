@@ -0,0 +1,47 @@
+package redis_distributed_lock
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// lua 脚本的 sha1 摘要，每个脚本只计算一次
+var scriptHashes sync.Map
+
+// lua 脚本的 sha1 摘要
+func scriptHash(src string) string {
+	if hash, ok := scriptHashes.Load(src); ok {
+		return hash.(string)
+	}
+	sum := sha1.Sum([]byte(src))
+	hash := hex.EncodeToString(sum[:])
+	scriptHashes.Store(src, hash)
+	return hash
+}
+
+// 执行 lua 脚本，与 redigo 的 redis.NewScript 一致，先通过 EVALSHA 执行缓存在服务端的脚本，
+// 服务端未缓存该脚本时返回 NOSCRIPT，此时改用 EVAL 执行，服务端会同时缓存该脚本，后续再次通过 EVALSHA 执行
+func evalSha(src string, keyCount int, keysAndArgs []interface{},
+	do func(cmd string, args ...interface{}) (interface{}, error)) (interface{}, error) {
+	args := make([]interface{}, 2+len(keysAndArgs))
+	args[0] = scriptHash(src)
+	args[1] = keyCount
+	copy(args[2:], keysAndArgs)
+	reply, err := do("EVALSHA", args...)
+	if !isNoScriptErr(err) {
+		return reply, err
+	}
+	args[0] = src
+	return do("EVAL", args...)
+}
+
+// 服务端未缓存脚本，例如 redis 重启、执行了 SCRIPT FLUSH 或者主从切换后
+func isNoScriptErr(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT")
+}
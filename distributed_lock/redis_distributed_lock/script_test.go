@@ -0,0 +1,74 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/gomodule/redigo/redis"
+)
+
+// 脚本通过 EVALSHA 执行，服务端未缓存脚本时回退到 EVAL
+func Test_evalSha(t *testing.T) {
+	m := miniredis.RunT(t)
+	var mu sync.Mutex
+	cmds := make(map[string]int)
+	m.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds[strings.ToUpper(cmd)]++
+		return false
+	})
+	count := func(cmd string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return cmds[cmd]
+	}
+	client := NewClient("tcp", m.Addr(), "")
+	lock := NewRedisLock("test_eval_sha_key", client, SetExpireSeconds(5))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 加锁、解锁脚本各自只通过 EVAL 执行一次
+	if got := count("EVAL"); got != 2 {
+		t.Errorf("got EVAL count: %d, expect: 2", got)
+	}
+	if got := count("EVALSHA"); got != 4 {
+		t.Errorf("got EVALSHA count: %d, expect: 4", got)
+	}
+	// 服务端清空脚本缓存后，重新通过 EVAL 执行
+	conn, err := redis.Dial("tcp", m.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SCRIPT", "FLUSH"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := count("EVAL"); got != 3 {
+		t.Errorf("got EVAL count: %d, expect: 3", got)
+	}
+	// 预先缓存脚本后，不再需要 EVAL
+	if err := client.LoadScripts(ctx, LuaCheckAndDeleteDistributedLock); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := count("EVAL"); got != 3 {
+		t.Errorf("got EVAL count: %d, expect: 3", got)
+	}
+	t.Log("success")
+}
@@ -0,0 +1,144 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redis分布式信号量，最多允许 permits 个持有者同时持有
+type RedisSemaphore struct {
+	LockOptions
+	key     string
+	permits int64
+	client  LockClient
+	dog     watchDog
+	// 是否已经持有许可，重复获取许可时不会重复启动看门狗
+	held bool
+	// 获取许可的时间，用于统计持有时间
+	acquiredAt time.Time
+}
+
+// 初始化，permits 小于 1 时按 1 处理
+func NewRedisSemaphore(key string, permits int64, client LockClient, opts ...LockOption) *RedisSemaphore {
+	if permits < 1 {
+		permits = 1
+	}
+	s := RedisSemaphore{
+		key:     key,
+		permits: permits,
+		client:  client,
+	}
+	for _, opt := range opts {
+		opt(&s.LockOptions)
+	}
+	checkLockOptions(&s.LockOptions)
+	return &s
+}
+
+// 信号量 key，持有者及其租约过期时间记录在 zset 中
+func (s *RedisSemaphore) getSemaphoreKey() string {
+	return s.lockKey(s.key)
+}
+
+// 许可释放通知频道
+func (s *RedisSemaphore) getChannel() string {
+	return s.getSemaphoreKey() + "_CHANNEL"
+}
+
+// 获取许可，阻塞模式下会等待其他持有者释放许可
+func (s *RedisSemaphore) Acquire(ctx context.Context) (err error) {
+	spanCtx, span := s.tracer.Start(ctx, "RedisSemaphore.Acquire", trace.WithAttributes(
+		attrLockKey.String(s.getSemaphoreKey()), attrBlockMode.Bool(s.blockMode)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = acquire(spanCtx, "RedisSemaphore.blockingLock", &s.LockOptions, s.client, []string{s.getChannel()},
+		s.metrics.countAttempts(s.tryAcquire))
+	s.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+	s.watchDog(ctx)
+	return nil
+}
+
+// 尝试获取许可一次，不论是否为阻塞模式
+func (s *RedisSemaphore) TryAcquire(ctx context.Context) (err error) {
+	spanCtx, span := s.tracer.Start(ctx, "RedisSemaphore.TryAcquire", trace.WithAttributes(
+		attrLockKey.String(s.getSemaphoreKey()), attrBlockMode.Bool(false)))
+	defer func() { endSpan(span, acquireOutcome(err), err) }()
+	start := time.Now()
+	err = s.metrics.countAttempts(s.tryAcquire)(spanCtx)
+	s.metrics.acquired(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+	s.watchDog(ctx)
+	return nil
+}
+
+// 尝试获取许可
+func (s *RedisSemaphore) tryAcquire(ctx context.Context) error {
+	keysAndArgs := []interface{}{s.getSemaphoreKey(), s.token, s.permits, s.expireSeconds}
+	reply, err := s.client.Eval(ctx, LuaSemaphoreAcquire, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("reply: %d, no permits available, err: %w", ret, ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 开启watchDog，为租约续期，宕机的持有者不再续期，其许可会在租约过期后被回收
+func (s *RedisSemaphore) watchDog(ctx context.Context) {
+	// 重复获取许可时，看门狗已经在运行
+	held := s.held
+	s.held = true
+	if !held {
+		s.acquiredAt = time.Now()
+	}
+	if !s.watchDogMode || held {
+		return
+	}
+	s.dog.start(ctx, s.watchDogStep, s.metrics.countRenewals(s.DelayExpire), nil)
+}
+
+// 更新租约的过期时间
+func (s *RedisSemaphore) DelayExpire(ctx context.Context, expireSeconds int64) (err error) {
+	ctx, span := s.tracer.Start(ctx, "RedisSemaphore.DelayExpire", trace.WithAttributes(
+		attrLockKey.String(s.getSemaphoreKey()), attrExpireSeconds.Int64(expireSeconds)))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeRenewed, err), err) }()
+	keysAndArgs := []interface{}{s.getSemaphoreKey(), s.token, expireSeconds}
+	reply, err := s.client.Eval(ctx, LuaCheckAndExpiredLease, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not expire semaphore lease, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
+
+// 释放许可
+func (s *RedisSemaphore) Release(ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "RedisSemaphore.Release", trace.WithAttributes(attrLockKey.String(s.getSemaphoreKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeReleased, err), err) }()
+	// 停止看门狗
+	defer func() {
+		s.held = false
+		s.dog.stop()
+		s.metrics.releasedSince(&s.acquiredAt)
+	}()
+	keysAndArgs := []interface{}{s.getSemaphoreKey(), s.token, s.getChannel()}
+	reply, err := s.client.Eval(ctx, LuaSemaphoreRelease, 1, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not release semaphore, err: %w", ErrLockNotOwned)
+	}
+	return nil
+}
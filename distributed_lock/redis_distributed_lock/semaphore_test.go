@@ -0,0 +1,66 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 信号量最多允许 permits 个持有者
+func Test_semaphore(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	sem1 := NewRedisSemaphore("test_semaphore_key", 2, client, SetExpireSeconds(5))
+	sem2 := NewRedisSemaphore("test_semaphore_key", 2, client, SetExpireSeconds(5))
+	sem3 := NewRedisSemaphore("test_semaphore_key", 2, client, SetExpireSeconds(5), ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := sem1.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem2.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem3.TryAcquire(ctx); err == nil || !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(200 * time.Millisecond)
+		if err := sem1.Release(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := sem3.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-released
+	if err := sem1.Release(ctx); err == nil {
+		t.Error("expect err when release without ownership")
+	}
+	if err := sem2.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem3.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 宕机持有者的许可在租约过期后被回收
+func Test_semaphoreLeaseExpired(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	crashed := NewRedisSemaphore("test_semaphore_lease_key", 1, client, SetExpireSeconds(1))
+	sem := NewRedisSemaphore("test_semaphore_lease_key", 1, client, SetExpireSeconds(5), ActiveBlockMode(), SetBlockWaitingSeconds(3))
+	ctx := context.Background()
+	if err := crashed.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
@@ -0,0 +1,120 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 创建一个通过哨兵发现主节点的redis客户端
+// 每次建立连接时向哨兵查询当前的主节点，主从切换后，连接池中原主节点的连接会在取用时被丢弃
+func NewSentinelClient(masterName string, sentinelAddrs []string, password string, opts ...ClientOption) *Client {
+	c := Client{
+		ClientOptions: ClientOptions{
+			network:  "tcp",
+			password: password,
+		},
+	}
+	for _, opt := range opts {
+		opt(&c.ClientOptions)
+	}
+	checkClientOptions(&c.ClientOptions)
+	c.sentinel = &sentinel{
+		masterName: masterName,
+		addrs:      append([]string(nil), sentinelAddrs...),
+		network:    c.network,
+		password:   c.sentinelPassword,
+	}
+	c.pool = c.getRedisPool()
+	c.metrics.watchClient(&c)
+	return &c
+}
+
+// 哨兵
+type sentinel struct {
+	mu         sync.Mutex
+	masterName string
+	addrs      []string
+	network    string
+	password   string
+}
+
+// 依次向各个哨兵查询主节点地址，查询成功的哨兵会被移动到列表头部，下次优先查询
+func (s *sentinel) masterAddr(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	addrs := append([]string(nil), s.addrs...)
+	s.mu.Unlock()
+	if len(addrs) == 0 {
+		return "", errors.New("no sentinel address configured")
+	}
+	var lastErr error
+	for i, addr := range addrs {
+		master, err := s.queryMasterAddr(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if i > 0 {
+			s.promote(addr)
+		}
+		return master, nil
+	}
+	return "", fmt.Errorf("can not get master addr from sentinels, err: %w", lastErr)
+}
+
+// 向单个哨兵查询主节点地址
+func (s *sentinel) queryMasterAddr(ctx context.Context, addr string) (string, error) {
+	var dialOpts []redis.DialOption
+	if len(s.password) > 0 {
+		dialOpts = append(dialOpts, redis.DialPassword(s.password))
+	}
+	conn, err := redis.DialContext(ctx, s.network, addr, dialOpts...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	reply, err := redis.Strings(redis.DoContext(conn, ctx, "SENTINEL", "get-master-addr-by-name", s.masterName))
+	if err != nil {
+		return "", err
+	}
+	if len(reply) != 2 {
+		return "", fmt.Errorf("master %s is unknown to sentinel %s", s.masterName, addr)
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// 将哨兵移动到列表头部
+func (s *sentinel) promote(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.addrs {
+		if a == addr {
+			copy(s.addrs[1:i+1], s.addrs[:i])
+			s.addrs[0] = addr
+			return
+		}
+	}
+}
+
+// 校验连接的节点是主节点
+func checkMasterRole(ctx context.Context, conn redis.Conn) error {
+	reply, err := redis.Values(redis.DoContext(conn, ctx, "ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("redis ROLE reply is empty")
+	}
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return fmt.Errorf("redis node is not master, role: %s", role)
+	}
+	return nil
+}
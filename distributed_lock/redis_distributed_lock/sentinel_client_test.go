@@ -0,0 +1,99 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// 模拟哨兵以及一主一从，failover 时交换主从
+type fakeSentinel struct {
+	mu       sync.Mutex
+	sentinel *miniredis.Miniredis
+	nodes    []*miniredis.Miniredis
+	master   int
+}
+
+func newFakeSentinel(t *testing.T) *fakeSentinel {
+	f := fakeSentinel{sentinel: miniredis.RunT(t), nodes: []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t)}}
+	f.sentinel.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if !strings.EqualFold(cmd, "SENTINEL") {
+			return false
+		}
+		if len(args) != 2 || args[1] != "mymaster" {
+			c.WriteNull()
+			return true
+		}
+		master := f.nodes[f.masterIndex()]
+		c.WriteStrings([]string{master.Host(), master.Port()})
+		return true
+	})
+	for i, node := range f.nodes {
+		i := i
+		node.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+			if !strings.EqualFold(cmd, "ROLE") {
+				return false
+			}
+			c.WriteLen(1)
+			if i == f.masterIndex() {
+				c.WriteBulk("master")
+			} else {
+				c.WriteBulk("slave")
+			}
+			return true
+		})
+	}
+	return &f
+}
+
+func (f *fakeSentinel) masterIndex() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.master
+}
+
+func (f *fakeSentinel) failover() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.master = 1 - f.master
+}
+
+// 哨兵客户端连接当前的主节点，主从切换后连接新的主节点
+func Test_sentinelClient(t *testing.T) {
+	f := newFakeSentinel(t)
+	// 第一个哨兵不可用
+	client := NewSentinelClient("mymaster", []string{"127.0.0.1:1", f.sentinel.Addr()}, "")
+	ctx := context.Background()
+	lock := NewRedisLock("test_sentinel_key", client, SetExpireSeconds(5))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !f.nodes[0].Exists(lock.getLockKey()) {
+		t.Error("expect lock key in master")
+	}
+	// 可用的哨兵被移动到列表头部
+	if client.sentinel.addrs[0] != f.sentinel.Addr() {
+		t.Errorf("got sentinels: %v, expect available sentinel first", client.sentinel.addrs)
+	}
+	f.failover()
+	other := NewRedisLock("test_sentinel_key", client, SetExpireSeconds(5))
+	if err := other.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !f.nodes[1].Exists(other.getLockKey()) {
+		t.Error("expect lock key in new master")
+	}
+	if err := other.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 不认识的主节点
+	unknown := NewSentinelClient("unknown", []string{f.sentinel.Addr()}, "")
+	if _, err := unknown.Get(ctx, "test_sentinel_key"); err == nil {
+		t.Error("expect err when master is unknown")
+	}
+	t.Log("success")
+}
@@ -0,0 +1,226 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 计算结果默认的保留时间，等待中的调用方收到通知后读取结果
+const DefaultSingleFlightResultTTL = 3 * time.Second
+
+var ErrSingleFlightLeaderFailed = errors.New("singleflight leader failed")
+
+// 结果的编码前缀
+const (
+	singleFlightValuePrefix = "v"
+	singleFlightErrorPrefix = "e"
+)
+
+// 跨进程的 singleflight，同一个 key 同一时刻只有一个调用方（leader）执行计算，
+// 计算结果写入 redis 并通过锁释放通知唤醒其他进程中等待的调用方复用结果，用于避免缓存击穿
+// 基于 RedisLock 实现，锁的前缀、命名空间等通过 LockOption 指定，未设置过期时间时由看门狗为计算中的 leader 续期
+type SingleFlight struct {
+	client    LockClient
+	resultTTL time.Duration
+	opts      []LockOption
+}
+
+// 初始化，计算成功的结果保留 resultTTL，期间新的调用方同样直接复用结果，resultTTL 小于等于 0 时使用 DefaultSingleFlightResultTTL
+func NewSingleFlight(client LockClient, resultTTL time.Duration, opts ...LockOption) *SingleFlight {
+	if resultTTL <= 0 {
+		resultTTL = DefaultSingleFlightResultTTL
+	}
+	return &SingleFlight{
+		client:    client,
+		resultTTL: resultTTL,
+		opts:      opts,
+	}
+}
+
+// 执行 key 对应的计算，其他调用方正在计算时等待并复用其结果，shared 表示结果是否来自其他调用方
+// leader 计算失败时，只有失败时已经在等待的调用方得到 ErrSingleFlightLeaderFailed，之后到达的调用方重新计算；
+// leader 的 ctx 终止或者宕机时，等待的调用方中的一个成为新的 leader 重新计算。等待时长由 ctx 控制
+func (s *SingleFlight) Do(ctx context.Context, key string,
+	fn func(ctx context.Context) ([]byte, error)) (value []byte, shared bool, err error) {
+	lock := NewRedisLock(key+"_SINGLEFLIGHT", s.client, s.opts...)
+	resultKey := lock.getLockKey() + "_RESULT"
+	err = s.lead(ctx, lock, func(ctx context.Context, since int64) (bool, error) {
+		// 读取其他调用方的计算结果
+		result, ok, err := getValue(ctx, s.client, resultKey)
+		if err != nil || !ok {
+			return false, err
+		}
+		var fence int64
+		fence, value, err = decodeSingleFlightResult(result)
+		// 失败的结果只交给 leader 计算期间已经在等待的调用方
+		if err != nil && (since == 0 || fence < since) {
+			return false, nil
+		}
+		shared = true
+		return true, err
+	}, func(ctx context.Context) error {
+		value, err = fn(ctx)
+		shared = false
+		// ctx 终止导致的失败不共享给其他调用方，由其他调用方重新计算
+		if isCtxErr(err) {
+			return err
+		}
+		if err := setValue(ctx, s.client, resultKey, encodeSingleFlightResult(lock.FencingToken(), value, err), s.resultTTL); err != nil {
+			return fmt.Errorf("can not publish singleflight result, err: %w", err)
+		}
+		return err
+	})
+	return value, shared, err
+}
+
+// 保证 key 对应的 fn 在整个集群中只成功执行一次，执行成功的标记保留 ttl，ttl 小于等于 0 时永久保留
+// 其他调用方正在执行时等待其结束：执行成功则直接返回，执行失败则由等待的调用方重新执行
+// executed 表示本次调用是否执行了 fn
+func (s *SingleFlight) DoOnce(ctx context.Context, key string, ttl time.Duration,
+	fn func(ctx context.Context) error) (executed bool, err error) {
+	lock := NewRedisLock(key+"_ONCE", s.client, s.opts...)
+	doneKey := lock.getLockKey() + "_DONE"
+	err = s.lead(ctx, lock, func(ctx context.Context, _ int64) (bool, error) {
+		_, done, err := getValue(ctx, s.client, doneKey)
+		return done, err
+	}, func(ctx context.Context) error {
+		executed = true
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		return setValue(ctx, s.client, doneKey, time.Now().Format(time.RFC3339Nano), ttl)
+	})
+	return executed, err
+}
+
+// 等待 done 返回 true，或者取得锁成为 leader 后执行 leader，结束后解锁并通知等待的调用方
+// done 的 since 为开始等待时 leader 的 fencing token，尚未开始等待时为 0
+func (s *SingleFlight) lead(ctx context.Context, lock *RedisLock,
+	done func(ctx context.Context, since int64) (bool, error), leader func(ctx context.Context) error) error {
+	var released <-chan struct{}
+	var subscribed bool
+	var since int64
+	for {
+		if ok, err := done(ctx, since); ok || err != nil {
+			return err
+		}
+		err := lock.TryLock(ctx)
+		if err == nil {
+			return s.runLeader(ctx, lock, done, leader)
+		}
+		if !IsRetryableErr(err) {
+			return err
+		}
+		// 首次等待时订阅锁释放通知，订阅后重新检查一次，避免错过订阅之前 leader 的解锁
+		if !subscribed {
+			var err error
+			if since, err = getFencingToken(ctx, lock); err != nil {
+				return err
+			}
+			var unsubscribe func()
+			released, unsubscribe = subscribeRelease(ctx, lock.client, []string{lock.getChannel()})
+			defer unsubscribe()
+			subscribed = true
+			continue
+		}
+		// 等待 leader 解锁，leader 宕机时不会发布通知，以兜底间隔轮询，直到锁过期后成为新的 leader
+		timer := time.NewTimer(DefaultReleaseFallbackPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-released:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// 以 leader 身份执行，取得锁之后再次检查 done，避免重复执行刚刚结束的 leader 已经完成的工作
+func (s *SingleFlight) runLeader(ctx context.Context, lock *RedisLock,
+	done func(ctx context.Context, since int64) (bool, error), leader func(ctx context.Context) error) (err error) {
+	defer func() {
+		// ctx 可能已经终止，使用独立的 ctx 保证能够解锁并通知等待的调用方
+		if unlockErr := lock.Unlock(context.WithoutCancel(ctx)); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+	if ok, err := done(ctx, 0); ok || err != nil {
+		return err
+	}
+	return leader(ctx)
+}
+
+// 读取锁当前的 fencing token，即最近一次取得锁的持有者的 token
+func getFencingToken(ctx context.Context, lock *RedisLock) (int64, error) {
+	value, ok, err := getValue(ctx, lock.client, lock.getFencingKey())
+	if err != nil || !ok {
+		return 0, err
+	}
+	fence, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fencing token, err: %w", err)
+	}
+	return fence, nil
+}
+
+// 读取 key 的值，key 不存在时 ok 为 false
+func getValue(ctx context.Context, client LockClient, key string) (value []byte, ok bool, err error) {
+	reply, err := client.Eval(ctx, LuaGetValue, 1, []interface{}{key})
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	switch v := reply.(type) {
+	case []byte:
+		return v, true, nil
+	case string:
+		return []byte(v), true, nil
+	default:
+		return nil, false, fmt.Errorf("unexpected reply type: %T", reply)
+	}
+}
+
+// 写入 key 的值，ttl 小于等于 0 时不过期
+func setValue(ctx context.Context, client LockClient, key, value string, ttl time.Duration) error {
+	_, err := client.Eval(ctx, LuaSetValue, 1, []interface{}{key, value, ttl.Milliseconds()})
+	return err
+}
+
+// 编码计算结果，失败时记录 leader 的 fencing token 和错误信息
+func encodeSingleFlightResult(fence int64, value []byte, err error) string {
+	if err != nil {
+		return singleFlightErrorPrefix + strconv.FormatInt(fence, 10) + ":" + err.Error()
+	}
+	return singleFlightValuePrefix + string(value)
+}
+
+// 解码计算结果，失败时 fence 为计算失败的 leader 的 fencing token
+func decodeSingleFlightResult(result []byte) (fence int64, value []byte, err error) {
+	if len(result) == 0 {
+		return 0, nil, errors.New("invalid singleflight result")
+	}
+	switch prefix, payload := string(result[:1]), result[1:]; prefix {
+	case singleFlightValuePrefix:
+		return 0, payload, nil
+	case singleFlightErrorPrefix:
+		token, msg, ok := strings.Cut(string(payload), ":")
+		if !ok {
+			return 0, nil, errors.New("invalid singleflight result")
+		}
+		if fence, err = strconv.ParseInt(token, 10, 64); err != nil {
+			return 0, nil, errors.New("invalid singleflight result")
+		}
+		return fence, nil, fmt.Errorf("%w, err: %s", ErrSingleFlightLeaderFailed, msg)
+	default:
+		return 0, nil, errors.New("invalid singleflight result")
+	}
+}
+
+// 是否为 ctx 终止导致的错误
+func isCtxErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,196 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"redis_distributed_lock/redistest"
+)
+
+// 并发调用只有一个调用方执行计算，其他调用方复用结果
+func Test_singleFlight(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	sf := NewSingleFlight(client, time.Second)
+	var calls, shared int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, ok, err := sf.Do(ctx, "user_1", func(ctx context.Context) ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(200 * time.Millisecond)
+				return []byte("alice"), nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(value) != "alice" {
+				t.Errorf("got value: %s, expect: alice", value)
+			}
+			if ok {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 || shared != 9 {
+		t.Errorf("got calls: %d, shared: %d, expect: 1, 9", calls, shared)
+	}
+	t.Log("success")
+}
+
+// leader 计算失败时等待的调用方得到 ErrSingleFlightLeaderFailed，之后到达的调用方以及 ctx 终止导致的失败重新计算
+func Test_singleFlightLeaderFailed(t *testing.T) {
+	client := newMemoryClient(t, nil)
+	ctx := context.Background()
+	sf := NewSingleFlight(client, time.Second)
+	started := make(chan struct{})
+	go func() {
+		_, _, _ = sf.Do(ctx, "user_1", func(ctx context.Context) ([]byte, error) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			return nil, errors.New("db is down")
+		})
+	}()
+	<-started
+	_, shared, err := sf.Do(ctx, "user_1", func(ctx context.Context) ([]byte, error) {
+		return []byte("alice"), nil
+	})
+	if !shared || !errors.Is(err, ErrSingleFlightLeaderFailed) {
+		t.Errorf("got shared: %v, err: %v, expect: true, %v", shared, err, ErrSingleFlightLeaderFailed)
+	}
+	// 失败之后到达的调用方不复用失败的结果，重新计算
+	value, shared, err := sf.Do(ctx, "user_1", func(ctx context.Context) ([]byte, error) {
+		return []byte("alice"), nil
+	})
+	if err != nil || shared || string(value) != "alice" {
+		t.Errorf("got value: %s, shared: %v, err: %v, expect: alice, false, nil", value, shared, err)
+	}
+
+	started = make(chan struct{})
+	go func() {
+		leaderCtx, cancel := context.WithCancel(ctx)
+		_, _, _ = sf.Do(leaderCtx, "user_2", func(ctx context.Context) ([]byte, error) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			cancel()
+			return nil, ctx.Err()
+		})
+	}()
+	<-started
+	value, shared, err = sf.Do(ctx, "user_2", func(ctx context.Context) ([]byte, error) {
+		return []byte("bob"), nil
+	})
+	if err != nil || shared || string(value) != "bob" {
+		t.Errorf("got value: %s, shared: %v, err: %v, expect: bob, false, nil", value, shared, err)
+	}
+	t.Log("success")
+}
+
+// 计算结果保留 resultTTL，过期后重新计算
+func Test_singleFlightResultTTL(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	ctx := context.Background()
+	sf := NewSingleFlight(client, time.Second, SetExpireSeconds(5))
+	var calls int32
+	fn := func(ctx context.Context) ([]byte, error) {
+		return []byte{byte('0' + atomic.AddInt32(&calls, 1))}, nil
+	}
+	if value, _, err := sf.Do(ctx, "user_1", fn); err != nil || string(value) != "1" {
+		t.Fatalf("got value: %s, err: %v, expect: 1", value, err)
+	}
+	if value, shared, err := sf.Do(ctx, "user_1", fn); err != nil || !shared || string(value) != "1" {
+		t.Fatalf("got value: %s, shared: %v, err: %v, expect: 1, true", value, shared, err)
+	}
+	clock.Advance(2 * time.Second)
+	if value, shared, err := sf.Do(ctx, "user_1", fn); err != nil || shared || string(value) != "2" {
+		t.Errorf("got value: %s, shared: %v, err: %v, expect: 2, false", value, shared, err)
+	}
+	t.Log("success")
+}
+
+// 并发调用只执行一次，执行失败时由下一个调用方重新执行，标记过期后再次执行
+func Test_doOnce(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	ctx := context.Background()
+	sf := NewSingleFlight(client, 0, SetExpireSeconds(5))
+	executed, err := sf.DoOnce(ctx, "migrate", time.Minute, func(ctx context.Context) error {
+		return errors.New("migrate failed")
+	})
+	if !executed || err == nil {
+		t.Fatalf("got executed: %v, err: %v, expect: true, error", executed, err)
+	}
+
+	var calls, executions int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executed, err := sf.DoOnce(ctx, "migrate", time.Minute, func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if executed {
+				atomic.AddInt32(&executions, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 || executions != 1 {
+		t.Fatalf("got calls: %d, executions: %d, expect: 1, 1", calls, executions)
+	}
+
+	clock.Advance(2 * time.Minute)
+	executed, err = sf.DoOnce(ctx, "migrate", time.Minute, func(ctx context.Context) error {
+		return nil
+	})
+	if !executed || err != nil {
+		t.Errorf("got executed: %v, err: %v, expect: true, nil", executed, err)
+	}
+	t.Log("success")
+}
+
+// 列出锁时跳过计算结果以及执行成功标记，但不影响以相同后缀结尾的锁
+func Test_singleFlightKeysNotListed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	sf := NewSingleFlight(client, time.Minute, SetExpireSeconds(5))
+	if _, _, err := sf.Do(ctx, "user_1", func(ctx context.Context) ([]byte, error) {
+		return []byte("alice"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.DoOnce(ctx, "migrate", time.Minute, func(ctx context.Context) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	lock := NewRedisLock("task_DONE", client, SetExpireSeconds(5))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := client.ListLocks(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Key != "task_DONE" {
+		t.Errorf("got locks: %+v, expect only task_DONE", infos)
+	}
+	t.Log("success")
+}
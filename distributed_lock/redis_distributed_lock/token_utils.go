@@ -1,11 +1,25 @@
 package redis_distributed_lock
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// linux 下记录本次开机唯一标识的文件
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+var (
+	processTokenOnce sync.Once
+	processToken     string
+	// 持有者 token 序号，保证每次生成的 token 不同
+	ownerTokenSeq int64
 )
 
 // 获取当前的进程ID
@@ -25,3 +39,42 @@ func GetCurrentGoroutineID() string {
 func GetProcessAndGoroutineIDStr() string {
 	return fmt.Sprintf("%s_%s", GetCurrentProcessID(), GetCurrentGoroutineID())
 }
+
+// 获取当前主机名，获取失败时返回空串
+func GetHostname() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// 获取本次开机的唯一标识，非 linux 系统下返回空串
+func GetBootID() string {
+	bootID, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bootID))
+}
+
+// 获取随机串
+func GetRandomNonce() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// 获取当前进程的全局唯一标识：主机名_开机ID_进程ID_随机串
+// 不同容器内的进程 ID 可能相同（例如都为 1），因此额外拼接主机名、开机 ID 以及进程启动时生成的随机串
+func GetProcessToken() string {
+	processTokenOnce.Do(func() {
+		processToken = fmt.Sprintf("%s_%s_%s_%s", GetHostname(), GetBootID(), GetCurrentProcessID(), GetRandomNonce())
+	})
+	return processToken
+}
+
+// 获取锁持有者的全局唯一 token：进程全局唯一标识_序号
+// 每次调用生成不同的 token，因此每个锁实例都是独立的持有者，与创建锁的协程无关
+func GetOwnerToken() string {
+	return fmt.Sprintf("%s_%d", GetProcessToken(), atomic.AddInt64(&ownerTokenSeq, 1))
+}
@@ -0,0 +1,74 @@
+package redis_distributed_lock
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracer 名称
+const tracerName = "redis_distributed_lock"
+
+// span 属性
+const (
+	attrLockKey       = attribute.Key("lock.key")
+	attrBlockMode     = attribute.Key("lock.block_mode")
+	attrBlockWaiting  = attribute.Key("lock.block_waiting_ms")
+	attrExpireSeconds = attribute.Key("lock.expire_seconds")
+	attrRetries       = attribute.Key("lock.retries")
+	attrOutcome       = attribute.Key("lock.outcome")
+)
+
+// span 的结果
+const (
+	OutcomeAcquired = "acquired"
+	OutcomeRenewed  = "renewed"
+	OutcomeReleased = "released"
+	OutcomeNotOwned = "not_owned"
+)
+
+// 为加锁、续期、解锁创建 span，未设置时不记录 span，对 RedisLock、RedisRWLock、RedisSemaphore、RedisMultiLock 均生效
+// 测试中可以使用 sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter())) 收集 span
+func SetTracerProvider(tp trace.TracerProvider) LockOption {
+	return func(o *LockOptions) {
+		o.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// 默认的 tracer，不记录 span
+func noopTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// 记录结果并结束 span
+func endSpan(span trace.Span, outcome string, err error) {
+	span.SetAttributes(attrOutcome.String(outcome))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// 加锁的结果
+func acquireOutcome(err error) string {
+	if err == nil {
+		return OutcomeAcquired
+	}
+	return failureReason(err)
+}
+
+// 续期、解锁的结果
+func ownershipOutcome(success string, err error) string {
+	switch {
+	case err == nil:
+		return success
+	case errors.Is(err, ErrLockNotOwned):
+		return OutcomeNotOwned
+	default:
+		return failureReason(err)
+	}
+}
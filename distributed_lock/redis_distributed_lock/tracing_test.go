@@ -0,0 +1,148 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// span 中的属性
+func spanAttr(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// 加锁、阻塞等锁、续期、解锁的 span
+func Test_lockTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client := newMemoryClient(t, nil)
+	holder := NewRedisLock("test_tracing_key", client, SetExpireSeconds(5), SetTracerProvider(tp))
+	waiter := NewRedisLock("test_tracing_key", client, SetExpireSeconds(5), SetTracerProvider(tp), ActiveBlockMode(),
+		SetBlockWaitingMillis(100), SetRetryStrategy(FixedIntervalRetry(20*time.Millisecond)))
+	ctx := context.Background()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Lock(ctx); err == nil {
+		t.Fatal("expect err when lock is acquired by others")
+	}
+	if err := holder.DelayExpire(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Unlock(ctx); err == nil {
+		t.Fatal("expect err when unlock twice")
+	}
+
+	spans := exporter.GetSpans()
+	expects := []struct {
+		name    string
+		outcome string
+		failed  bool
+	}{
+		{"RedisLock.Lock", OutcomeAcquired, false},
+		{"RedisLock.blockingLock", FailureReasonAcquiredByOthers, true},
+		{"RedisLock.Lock", FailureReasonAcquiredByOthers, true},
+		{"RedisLock.DelayExpire", OutcomeRenewed, false},
+		{"RedisLock.Unlock", OutcomeReleased, false},
+		{"RedisLock.Unlock", OutcomeNotOwned, true},
+	}
+	if len(spans) != len(expects) {
+		t.Fatalf("got spans: %d, expect: %d", len(spans), len(expects))
+	}
+	for i, expect := range expects {
+		span := spans[i]
+		if span.Name != expect.name {
+			t.Errorf("span %d got name: %s, expect: %s", i, span.Name, expect.name)
+		}
+		if outcome, _ := spanAttr(span, attrOutcome); outcome.AsString() != expect.outcome {
+			t.Errorf("span %s got outcome: %s, expect: %s", span.Name, outcome.AsString(), expect.outcome)
+		}
+		if failed := span.Status.Code == codes.Error; failed != expect.failed {
+			t.Errorf("span %s got error status: %v, expect: %v", span.Name, failed, expect.failed)
+		}
+	}
+	// 阻塞等锁的 span 是加锁 span 的子 span，并记录了重试次数
+	if spans[1].Parent.SpanID() != spans[2].SpanContext.SpanID() {
+		t.Error("expect blockingLock span to be child of Lock span")
+	}
+	if retries, _ := spanAttr(spans[1], attrRetries); retries.AsInt64() < 1 {
+		t.Errorf("got retries: %d, expect at least 1", retries.AsInt64())
+	}
+	if key, _ := spanAttr(spans[0], attrLockKey); key.AsString() != holder.getLockKey() {
+		t.Errorf("got key: %s, expect: %s", key.AsString(), holder.getLockKey())
+	}
+	if mode, _ := spanAttr(spans[2], attrBlockMode); !mode.AsBool() {
+		t.Error("expect block mode attribute to be true")
+	}
+	t.Log("success")
+}
+
+// 读写锁、信号量的加锁、阻塞等锁、解锁的 span
+func Test_rwLockAndSemaphoreTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client := newMemoryClient(t, nil)
+	reader := NewRedisRWLock("test_tracing_rw_key", client, SetExpireSeconds(5), SetTracerProvider(tp),
+		SetOwnerToken("reader"))
+	writer := NewRedisRWLock("test_tracing_rw_key", client, SetExpireSeconds(5), SetTracerProvider(tp), ActiveBlockMode(),
+		SetBlockWaitingMillis(100), SetRetryStrategy(FixedIntervalRetry(20*time.Millisecond)), SetOwnerToken("writer"))
+	semaphore := NewRedisSemaphore("test_tracing_semaphore_key", 1, client, SetExpireSeconds(5), SetTracerProvider(tp))
+	ctx := context.Background()
+	if err := reader.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Lock(ctx); err == nil {
+		t.Fatal("expect err when read lock is held")
+	}
+	if err := reader.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := semaphore.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := semaphore.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	expects := []struct {
+		name    string
+		outcome string
+	}{
+		{"RedisRWLock.RLock", OutcomeAcquired},
+		{"RedisRWLock.blockingLock", FailureReasonAcquiredByOthers},
+		{"RedisRWLock.Lock", FailureReasonAcquiredByOthers},
+		{"RedisRWLock.RUnlock", OutcomeReleased},
+		{"RedisSemaphore.Acquire", OutcomeAcquired},
+		{"RedisSemaphore.Release", OutcomeReleased},
+	}
+	if len(spans) != len(expects) {
+		t.Fatalf("got spans: %d, expect: %d", len(spans), len(expects))
+	}
+	for i, expect := range expects {
+		span := spans[i]
+		if span.Name != expect.name {
+			t.Errorf("span %d got name: %s, expect: %s", i, span.Name, expect.name)
+		}
+		if outcome, _ := spanAttr(span, attrOutcome); outcome.AsString() != expect.outcome {
+			t.Errorf("span %s got outcome: %s, expect: %s", span.Name, outcome.AsString(), expect.outcome)
+		}
+	}
+	if spans[1].Parent.SpanID() != spans[2].SpanContext.SpanID() {
+		t.Error("expect blockingLock span to be child of RWLock.Lock span")
+	}
+	t.Log("success")
+}
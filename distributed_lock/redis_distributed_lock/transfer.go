@@ -0,0 +1,65 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span 的结果
+const (
+	OutcomeTransferred = "transferred"
+	OutcomeAdopted     = "adopted"
+)
+
+// 将持有的锁原子地转移给 newToken，锁的剩余过期时间以及可重入锁的重入次数保持不变，期间其他人无法取得锁
+// 转移后当前实例停止看门狗并不再持有锁，接收方需要通过 SetOwnerToken(newToken) 以相同的配置创建锁并调用 Adopt 接管续期，
+// 在接收方接管之前，锁只会保留到剩余的过期时间。转移会递增 fencing token，原持有者的 fencing token 随之失效
+func (r *RedisLock) Transfer(ctx context.Context, newToken string) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RedisLock.Transfer", trace.WithAttributes(attrLockKey.String(r.getLockKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeTransferred, err), err) }()
+	if newToken == "" || newToken == r.token {
+		return errors.New("new token must be non-empty and different from current token")
+	}
+	keysAndArgs := []interface{}{r.getLockKey(), r.getFencingKey(), r.getMetadataKey(), r.token, newToken}
+	reply, err := r.client.Eval(ctx, LuaTransferLock, 3, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret <= 0 {
+		return fmt.Errorf("can not transfer lock, err: %w", ErrLockNotOwned)
+	}
+	r.reentrantCount = 0
+	r.release()
+	return nil
+}
+
+// 接管通过 Transfer 转移给当前 token 的锁，成功后与加锁成功一样开始持有锁：刷新锁的过期时间、启动看门狗，
+// 记录当前 token 的元数据，并通过 FencingToken 返回转移时递增的 fencing token
+// 锁未转移给当前 token 时返回 ErrLockNotOwned
+func (r *RedisLock) Adopt(ctx context.Context) (err error) {
+	spanCtx, span := r.tracer.Start(ctx, "RedisLock.Adopt", trace.WithAttributes(attrLockKey.String(r.getLockKey())))
+	defer func() { endSpan(span, ownershipOutcome(OutcomeAdopted, err), err) }()
+	keysAndArgs := []interface{}{r.getLockKey(), r.getFencingKey(), r.token, r.expireSeconds}
+	ret, err := redis.Int64s(r.eval(spanCtx, LuaAdoptLock, 2, keysAndArgs, r.lockMetadataArgs(spanCtx)))
+	if err != nil {
+		return err
+	}
+	if len(ret) != 2 || ret[0] <= 0 {
+		return fmt.Errorf("reply: %v, can not adopt lock, err: %w", ret, ErrLockNotOwned)
+	}
+	r.reentrantCount, r.fencingToken = ret[0], ret[1]
+	// 重复接管时先结束之前的持有状态，避免看门狗重复启动
+	r.release()
+	r.lease = newLockLease()
+	r.lockedAt = time.Now()
+	if !r.watchDogMode {
+		r.lease.expireAfter(time.Duration(r.expireSeconds) * time.Second)
+	}
+	r.watchDog(ctx)
+	return nil
+}
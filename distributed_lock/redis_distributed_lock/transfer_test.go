@@ -0,0 +1,115 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"redis_distributed_lock/redistest"
+)
+
+// 协调者将锁转移给执行者，执行者接管续期，期间其他人无法取得锁
+func Test_transferLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient("tcp", mr.Addr(), "", SetMaxIdleLinks(2))
+	ctx := context.Background()
+	coordinator := NewRedisLock("test_transfer_key", client, SetOwnerToken("coordinator"), SetExpireSeconds(10),
+		SetLockMetadata(LockMetadata{Service: "coordinator"}))
+	worker := NewRedisLock("test_transfer_key", client, SetOwnerToken("worker"), SetExpireSeconds(20),
+		SetLockMetadata(LockMetadata{Service: "worker"}))
+	other := NewRedisLock("test_transfer_key", client, SetOwnerToken("other"))
+	if err := coordinator.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.Adopt(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	if err := other.Transfer(ctx, "other_worker"); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	mr.FastForward(4 * time.Second)
+	if err := coordinator.Transfer(ctx, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	// 转移后保留锁的剩余过期时间，原持有者的元数据被删除
+	if ttl := mr.TTL(coordinator.getLockKey()); ttl != 6*time.Second {
+		t.Errorf("got ttl: %v, expect: 6s", ttl)
+	}
+	if info, err := client.Inspect(ctx, "test_transfer_key"); err != nil || info.Owners[0].Token != "worker" || info.Metadata != nil {
+		t.Errorf("got lock: %+v, err: %v, expect owned by worker without metadata", info, err)
+	}
+	if err := other.TryLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockAcquiredByOthers)
+	}
+	if err := coordinator.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+
+	if err := worker.Adopt(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if worker.FencingToken() <= coordinator.FencingToken() {
+		t.Errorf("got fencing token: %d, expect greater than: %d", worker.FencingToken(), coordinator.FencingToken())
+	}
+	if ttl := mr.TTL(worker.getLockKey()); ttl != 20*time.Second {
+		t.Errorf("got ttl: %v, expect: 20s", ttl)
+	}
+	if info, err := client.Inspect(ctx, "test_transfer_key"); err != nil || info.Metadata == nil || info.Metadata.Service != "worker" {
+		t.Errorf("got lock: %+v, err: %v, expect metadata of worker", info, err)
+	}
+	if worker.Lost() == nil {
+		t.Error("expect worker to hold the lock")
+	}
+	if err := worker.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("success")
+}
+
+// 可重入锁转移后保留重入次数，接管后看门狗为锁续期
+func Test_transferReentrantLock(t *testing.T) {
+	clock := redistest.NewManualClock(time.Now())
+	client := newMemoryClient(t, clock)
+	ctx := context.Background()
+	coordinator := NewRedisLock("test_transfer_reentrant_key", client, SetOwnerToken("coordinator"), ActiveReentrantMode())
+	worker := NewRedisLock("test_transfer_reentrant_key", client, SetOwnerToken("worker"), ActiveReentrantMode())
+	worker.watchDogStep = 1
+	for i := 0; i < 2; i++ {
+		if err := coordinator.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(4 * time.Second)
+	if err := coordinator.Transfer(ctx, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	// 转移后保留锁的剩余过期时间
+	expect := time.Duration(DefaultDistributedLockExpireSeconds-4) * time.Second
+	pttl, err := redis.Int64(client.Eval(ctx, `return redis.call('pttl', KEYS[1])`, 1,
+		[]interface{}{coordinator.getLockKey()}))
+	if err != nil || time.Duration(pttl)*time.Millisecond != expect {
+		t.Errorf("got pttl: %d, err: %v, expect: %v", pttl, err, expect)
+	}
+	if err := worker.Adopt(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if worker.reentrantCount != 2 {
+		t.Errorf("got reentrant count: %d, expect: 2", worker.reentrantCount)
+	}
+	// 临近过期时等待看门狗续期，续期后越过初始的过期时间
+	clock.Advance(time.Duration(DefaultDistributedLockExpireSeconds-1) * time.Second)
+	time.Sleep(1500 * time.Millisecond)
+	clock.Advance(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if err := worker.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := worker.Unlock(ctx); !errors.Is(err, ErrLockNotOwned) {
+		t.Errorf("got err: %v, expect: %v", err, ErrLockNotOwned)
+	}
+	t.Log("success")
+}
@@ -0,0 +1,92 @@
+package redis_distributed_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 续期失败但锁尚未过期时，看门狗的重试间隔
+const watchDogRetryInterval = time.Second
+
+// 看门狗因为解锁而停止，不视为锁丢失
+var errWatchDogStopped = errors.New("watchdog stopped")
+
+// 看门狗，在用户未显式解锁时持续为锁续期
+type watchDog struct {
+	running int32
+	cancel  context.CancelCauseFunc
+}
+
+// 启动看门狗，每隔 stepSeconds 秒调用 renew 续期一次
+// 续期因为锁已不归属自己而失败、持续失败直到锁过期，或者 ctx 在解锁之前终止时，调用 onLost 并退出
+func (w *watchDog) start(ctx context.Context, stepSeconds int64,
+	renew func(ctx context.Context, expireSeconds int64) error, onLost func(err error)) {
+	// 1. 确保之前启动的看门狗已经正常回收
+	for !atomic.CompareAndSwapInt32(&w.running, 0, 1) {
+	}
+	// 2. 启动看门狗
+	ctx, w.cancel = context.WithCancelCause(ctx)
+	go func() {
+		defer func() {
+			atomic.StoreInt32(&w.running, 0)
+		}()
+		w.run(ctx, stepSeconds, renew, onLost)
+	}()
+}
+
+// 通过定时器轮询
+func (w *watchDog) run(ctx context.Context, stepSeconds int64,
+	renew func(ctx context.Context, expireSeconds int64) error, onLost func(err error)) {
+	// 为避免因为网络延迟而导致锁被提前释放的问题，续约时需要把锁的过期时长额外增加 5 s
+	expireSeconds := stepSeconds + 5
+	step := time.Duration(stepSeconds) * time.Second
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	expireAt := time.Now().Add(time.Duration(expireSeconds) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			stopped(ctx, onLost)
+			return
+		case <-ticker.C:
+		}
+		err := renew(ctx, expireSeconds)
+		if err == nil {
+			expireAt = time.Now().Add(time.Duration(expireSeconds) * time.Second)
+			ticker.Reset(step)
+			continue
+		}
+		// 续期过程中看门狗被停止
+		if ctx.Err() != nil {
+			stopped(ctx, onLost)
+			return
+		}
+		// 锁已经不归属自己，或者直到锁过期都没能续期成功
+		if errors.Is(err, ErrLockNotOwned) || !time.Now().Before(expireAt) {
+			if onLost != nil {
+				onLost(err)
+			}
+			return
+		}
+		// 锁尚未过期，缩短间隔尽快重试
+		ticker.Reset(watchDogRetryInterval)
+	}
+}
+
+// 看门狗的 ctx 终止，不是因为解锁而停止时，锁不再续期并会在过期后被释放，因此通知锁丢失
+func stopped(ctx context.Context, onLost func(err error)) {
+	if onLost == nil || errors.Is(context.Cause(ctx), errWatchDogStopped) {
+		return
+	}
+	onLost(fmt.Errorf("watchdog stopped before unlock, err: %w", ctx.Err()))
+}
+
+// 停止看门狗
+func (w *watchDog) stop() {
+	if w.cancel != nil {
+		w.cancel(errWatchDogStopped)
+	}
+}